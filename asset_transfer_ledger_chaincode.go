@@ -24,8 +24,10 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	// "github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
@@ -41,6 +43,7 @@ type SimpleChaincode struct {
 }
 
 type Trainer struct {
+	DocType			string `json:"docType"`
 	TrainerID    	string
 	FirstName		string
 	LastName		string
@@ -51,15 +54,21 @@ type Trainer struct {
 }
 
 type Platform struct {
+	DocType			string `json:"docType"`
 	PlatformID  	string
 	PlatformName 	string
 	EmailAddress 	string				
 	Description 	string
 	Trainees    	[]Trainee
 	Vlabs			[]Vlab
+	// Season is the number of closed seasons, and SeasonStartedAt is when
+	// the current season started
+	Season			int `json:"Season,omitempty"`
+	SeasonStartedAt	*time.Time `json:"SeasonStartedAt,omitempty"`
 }
 
 type Trainee struct {
+	DocType				string `json:"docType"`
 	TraineeID     		string
 	FirstName    		string 
 	LastName     		string 
@@ -69,10 +78,22 @@ type Trainee struct {
 	Nickname 			string
 	ActivePlatform    	string
 	Total_Exp_Points	string
+	// TotalExpPoints mirrors Total_Exp_Points as a number so that CouchDB
+	// range selectors compare it numerically
+	TotalExpPoints		int `json:"totalExpPoints"`
+	// Level is the rank tier reached with TotalExpPoints
+	Level				string
+	// LastCompletion is the time the trainee's last vlab was scored and
+	// breaks ties on the leaderboard
+	LastCompletion		time.Time
+	// CarriedOver are the points of closed seasons the trainee started the
+	// current season with
+	CarriedOver			int `json:"CarriedOver,omitempty"`
 	VlabPointsMap2 map[string]Vlab    `json:"Trainee_vlabs"`
 }
 
 type Vlab struct {
+	DocType			string `json:"docType"`
 	VlabID 			string `json:"vlabID"`
 	BoxName 		string
     Domain 			string
@@ -82,10 +103,36 @@ type Vlab struct {
     BoxDifficulty  	string
     TimeNeeded 		string
 	Result 			string
+	// TimeSpent is the time the trainee reported for the vlab, in the unit
+	// of TimeNeeded
+	TimeSpent 		string
+	// AwardedPoints is what Result earned under the platform's scoring rules
+	AwardedPoints 	int
+	// StartTime and Deadline are the optional window of an assignment, and
+	// GradedAt is when Result was recorded
+	StartTime 		*time.Time `json:"StartTime,omitempty"`
+	Deadline 		*time.Time `json:"Deadline,omitempty"`
+	GradedAt 		*time.Time `json:"GradedAt,omitempty"`
+	// Prerequisites are the vlabs a trainee must pass before this one can
+	// be assigned
+	Prerequisites 	[]string `json:"Prerequisites,omitempty"`
+	// EventID is the competition event whose dynamic scoring awarded the
+	// points of Result
+	EventID 		string `json:"EventID,omitempty"`
+	// Rubric is the weighted criteria the vlab is graded on, and
+	// CriterionScores are the trainee's scores per criterion
+	Rubric 			*Rubric `json:"Rubric,omitempty"`
+	CriterionScores map[string]float64 `json:"CriterionScores,omitempty"`
+	// TokensMinted is the most reward tokens ever minted for the result
+	TokensMinted 	int `json:"TokensMinted,omitempty"`
+	// ClosedSeason is the closed season the points of Result counted in, 0
+	// while they count in the current season
+	ClosedSeason 	int `json:"ClosedSeason,omitempty"`
 	// Add other fields as needed
 }
 
 type Administrator struct{
+	DocType			string `json:"docType"`
 	AdministratorID string
 	FirstName		string
 	LastName		string
@@ -96,6 +143,7 @@ type Administrator struct{
 }
 
 type VlabOwner struct{
+	DocType			string `json:"docType"`
 	VLabOwnerID		string
 	FirstName		string
 	LastName		string
@@ -116,6 +164,21 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("ex02 Invoke")
+
+	// Buffer the typed events of the function and set them only if it succeeds
+	events := &eventStub{ChaincodeStubInterface: stub}
+	response := t.invokeFunction(events)
+	if response.Status < shim.ERRORTHRESHOLD {
+		err := events.flushEvents()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return response
+}
+
+func (t *SimpleChaincode) invokeFunction(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
 	if function == "createTrainee" {
 		return t.createTrainee(stub, args)
@@ -149,6 +212,136 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.addVlabToPlatform(stub, args)
 	} else if function == "calculateExpPoints" {
 		return t.calculateExpPoints(stub, args)
+	} else if function == "listTrainees" {
+		return t.listTrainees(stub, args)
+	} else if function == "listPlatforms" {
+		return t.listPlatforms(stub, args)
+	} else if function == "listVlabs" {
+		return t.listVlabs(stub, args)
+	} else if function == "listTrainers" {
+		return t.listTrainers(stub, args)
+	} else if function == "listAdministrators" {
+		return t.listAdministrators(stub, args)
+	} else if function == "listVlabOwners" {
+		return t.listVlabOwners(stub, args)
+	} else if function == "reindexAssets" {
+		return t.reindexAssets(stub, args)
+	} else if function == "queryTraineesByCity" {
+		return t.queryTraineesByCity(stub, args)
+	} else if function == "queryVlabsByDomainAndDifficulty" {
+		return t.queryVlabsByDomainAndDifficulty(stub, args)
+	} else if function == "queryTraineesByMinExpPoints" {
+		return t.queryTraineesByMinExpPoints(stub, args)
+	} else if function == "getHistory" {
+		return t.getHistory(stub, args)
+	} else if function == "getLeaderboard" {
+		return t.getLeaderboard(stub, args)
+	} else if function == "getPlatformStats" {
+		return t.getPlatformStats(stub, args)
+	} else if function == "getTranscript" {
+		return t.getTranscript(stub, args)
+	} else if function == "getTraineeAsOf" {
+		return t.getTraineeAsOf(stub, args)
+	} else if function == "getPlatformAsOf" {
+		return t.getPlatformAsOf(stub, args)
+	} else if function == "getVlabAsOf" {
+		return t.getVlabAsOf(stub, args)
+	} else if function == "removeVlabScore" {
+		return t.removeVlabScore(stub, args)
+	} else if function == "setScoringRules" {
+		return t.setScoringRules(stub, args)
+	} else if function == "getScoringRules" {
+		return t.getScoringRules(stub, args)
+	} else if function == "setLevelThresholds" {
+		return t.setLevelThresholds(stub, args)
+	} else if function == "getLevelThresholds" {
+		return t.getLevelThresholds(stub, args)
+	} else if function == "createBadge" {
+		return t.createBadge(stub, args)
+	} else if function == "listBadges" {
+		return t.listBadges(stub, args)
+	} else if function == "getBadgeHolders" {
+		return t.getBadgeHolders(stub, args)
+	} else if function == "getCertificate" {
+		return t.getCertificate(stub, args)
+	} else if function == "listCertificates" {
+		return t.listCertificates(stub, args)
+	} else if function == "verifyCertificate" {
+		return t.verifyCertificate(stub, args)
+	} else if function == "revokeCertificate" {
+		return t.revokeCertificate(stub, args)
+	} else if function == "exportCredential" {
+		return t.exportCredential(stub, args)
+	} else if function == "setIssuerProfile" {
+		return t.setIssuerProfile(stub, args)
+	} else if function == "listOverdueAssignments" {
+		return t.listOverdueAssignments(stub, args)
+	} else if function == "setVlabPrerequisites" {
+		return t.setVlabPrerequisites(stub, args)
+	} else if function == "getPrerequisiteTree" {
+		return t.getPrerequisiteTree(stub, args)
+	} else if function == "createLearningPath" {
+		return t.createLearningPath(stub, args)
+	} else if function == "listLearningPaths" {
+		return t.listLearningPaths(stub, args)
+	} else if function == "enrollInLearningPath" {
+		return t.enrollInLearningPath(stub, args)
+	} else if function == "getPathProgress" {
+		return t.getPathProgress(stub, args)
+	} else if function == "createTeam" {
+		return t.createTeam(stub, args)
+	} else if function == "addTeamMember" {
+		return t.addTeamMember(stub, args)
+	} else if function == "removeTeamMember" {
+		return t.removeTeamMember(stub, args)
+	} else if function == "moveTeamMember" {
+		return t.moveTeamMember(stub, args)
+	} else if function == "getTeam" {
+		return t.getTeam(stub, args)
+	} else if function == "getTeamLeaderboard" {
+		return t.getTeamLeaderboard(stub, args)
+	} else if function == "createEvent" {
+		return t.createEvent(stub, args)
+	} else if function == "getEvent" {
+		return t.getEvent(stub, args)
+	} else if function == "listEvents" {
+		return t.listEvents(stub, args)
+	} else if function == "getEventScoreboard" {
+		return t.getEventScoreboard(stub, args)
+	} else if function == "getEventSolves" {
+		return t.getEventSolves(stub, args)
+	} else if function == "openDispute" {
+		return t.openDispute(stub, args)
+	} else if function == "respondToDispute" {
+		return t.respondToDispute(stub, args)
+	} else if function == "resolveDispute" {
+		return t.resolveDispute(stub, args)
+	} else if function == "getDispute" {
+		return t.getDispute(stub, args)
+	} else if function == "listDisputes" {
+		return t.listDisputes(stub, args)
+	} else if function == "setVlabRubric" {
+		return t.setVlabRubric(stub, args)
+	} else if function == "getCriterionResults" {
+		return t.getCriterionResults(stub, args)
+	} else if function == "closeSeason" {
+		return t.closeSeason(stub, args)
+	} else if function == "getSeasonStandings" {
+		return t.getSeasonStandings(stub, args)
+	} else if function == "listSeasons" {
+		return t.listSeasons(stub, args)
+	} else if function == "setTokenTransfers" {
+		return t.setTokenTransfers(stub, args)
+	} else if function == "transferTokens" {
+		return t.transferTokens(stub, args)
+	} else if function == "burnTokens" {
+		return t.burnTokens(stub, args)
+	} else if function == "tokenBalance" {
+		return t.tokenBalance(stub, args)
+	} else if function == "tokenTotalSupply" {
+		return t.tokenTotalSupply(stub, args)
+	} else if function == "getTokenTransactions" {
+		return t.getTokenTransactions(stub, args)
 	}
 
 	
@@ -180,6 +373,7 @@ func (t *SimpleChaincode) createTrainee(stub shim.ChaincodeStubInterface, args [
 
 	// Create a new trainee object
 	trainee := Trainee{
+		DocType:		traineeObjectType,
 		TraineeID:     	traineeID,
 		FirstName:      firstName,
 		LastName:       lastName,
@@ -191,6 +385,12 @@ func (t *SimpleChaincode) createTrainee(stub shim.ChaincodeStubInterface, args [
 		VlabPointsMap2: make(map[string]Vlab),
 	}
 
+	// Every trainee starts at the lowest level
+	err = setLevel(stub, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Convert trainee object to JSON
 	traineeJSON, err := json.Marshal(trainee)
 	if err != nil {
@@ -203,6 +403,20 @@ func (t *SimpleChaincode) createTrainee(stub shim.ChaincodeStubInterface, args [
 		return shim.Error(err.Error())
 	}
 
+	// Record the trainee in its type index
+	err = putObjectIndex(stub, traineeObjectType, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TraineeCreatedEventType, TraineeCreatedEvent{
+		TraineeID: traineeID,
+		Trainee:   trainee,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -228,6 +442,7 @@ func (t *SimpleChaincode) createPlatform(stub shim.ChaincodeStubInterface, args
 
 	// Create a new Platform object
 	platform := Platform{
+		DocType: platformObjectType,
 		PlatformID:  platformID,
 		PlatformName:   platformName,
 		EmailAddress:  emailAddress,
@@ -248,6 +463,20 @@ func (t *SimpleChaincode) createPlatform(stub shim.ChaincodeStubInterface, args
 		return shim.Error(err.Error())
 	}
 
+	// Record the platform in its type index
+	err = putObjectIndex(stub, platformObjectType, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, PlatformCreatedEventType, PlatformCreatedEvent{
+		PlatformID: platformID,
+		Platform:   platform,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -302,6 +531,7 @@ func (t *SimpleChaincode) addTraineeToPlatform(stub shim.ChaincodeStubInterface,
 	}
 
 	if trainee.ActivePlatform == "" {
+		previous := trainee
 		trainee.ActivePlatform = PlatformID
 		// Convert trainee object to JSON
 		updatedTraineeJSON, err := json.Marshal(trainee)
@@ -313,6 +543,26 @@ func (t *SimpleChaincode) addTraineeToPlatform(stub shim.ChaincodeStubInterface,
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		// Rank the trainee on the platform's leaderboard
+		err = updateLeaderboard(stub, &previous, &trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Open the platform membership in the trainee's transcript
+		err = updateTranscript(stub, role, func(transcript *Transcript, at time.Time) {
+			transcript.join(PlatformID, at)
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = emitEvent(stub, TraineeAddedToPlatformEventType, TraineeAddedToPlatformEvent{
+			AdministratorID: administratorID,
+			TraineeID:       role,
+			PlatformID:      PlatformID,
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 		platform.Trainees = append(platform.Trainees, trainee)
 	} else {
 		return shim.Error("TraineeID is already registered in ActivePlatform, you need to transfer first")
@@ -358,6 +608,7 @@ func (t *SimpleChaincode) createTrainer(stub shim.ChaincodeStubInterface, args [
 
 	// Create a new trainer object
 	trainer := Trainer{
+		DocType:			trainerObjectType,
 		TrainerID:     		trainerID,
 		FirstName:    		firstName,
 		LastName: 			lastName,
@@ -379,6 +630,20 @@ func (t *SimpleChaincode) createTrainer(stub shim.ChaincodeStubInterface, args [
 		return shim.Error(err.Error())
 	}
 
+	// Record the trainer in its type index
+	err = putObjectIndex(stub, trainerObjectType, trainerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TrainerCreatedEventType, TrainerCreatedEvent{
+		TrainerID: trainerID,
+		Trainer:   trainer,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -409,30 +674,99 @@ func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string
 
 	A := args[0]
 
+	// A deleted trainee must not stay on a leaderboard
+	valueBytes, err := stub.GetState(A)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if valueBytes != nil && objectTypeOf(valueBytes) == traineeObjectType {
+		trainee := Trainee{}
+		err = json.Unmarshal(valueBytes, &trainee)
+		if err != nil {
+			return shim.Error("Failed to unmarshal trainee JSON")
+		}
+		err = updateLeaderboard(stub, &trainee, nil)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
 	// Delete the key from the state in ledger
-	err := stub.DelState(A)
+	err = stub.DelState(A)
+	if err != nil {
+		return shim.Error("Failed to delete state")
+	}
+
+	// Drop the key from the type indexes as well
+	err = delObjectIndex(stub, A)
 	if err != nil {
 		return shim.Error("Failed to delete state")
 	}
 
+	entityType := ""
+	if valueBytes != nil {
+		entityType = objectTypeOf(valueBytes)
+	}
+	err = emitEvent(stub, EntityDeletedEventType, EntityDeletedEvent{
+		ID:         A,
+		EntityType: entityType,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
+// ScoreTheVlab records a trainee's result for a vlab. The result is a
+// percentage or pass/fail, depending on the platform's scoring rules, or a
+// JSON object of criterion scores if the vlab has a rubric.
+// Arguments: trainerID, traineeID, vlabID, result, optional timeSpent
 func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
 	}
 
-	trainerID := args[0]
-	traineeID := args[1]
-	vlabID := args[2]
-	vlabResult := args[3]
+	timeSpent := ""
+	if len(args) == 5 {
+		timeSpent = args[4]
+		spent, err := strconv.ParseFloat(timeSpent, 64)
+		if err != nil || spent < 0 {
+			return shim.Error("timeSpent must be a non-negative number")
+		}
+	}
+	if args[3] == "" {
+		return shim.Error("Result must not be empty")
+	}
 
 	// Check if trainerID starts with "trainer"
-	if !strings.HasPrefix(trainerID, "Trainer") {
+	if !strings.HasPrefix(args[0], "Trainer") {
 		return shim.Error("Not authorized for that transaction.")
 	}
 
+	return t.setVlabResult(stub, args[0], args[1], args[2], args[3], timeSpent, nil)
+}
+
+// removeVlabScore clears the result of a scored vlab.
+// Arguments: trainerID, traineeID, vlabID
+func (t *SimpleChaincode) removeVlabScore(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// Check if trainerID starts with "trainer"
+	if !strings.HasPrefix(args[0], "Trainer") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	return t.setVlabResult(stub, args[0], args[1], args[2], "", "", nil)
+}
+
+// setVlabResult records, changes or clears a trainee's result for a vlab and
+// updates the trainee's experience points in the same transaction. The
+// result is graded at gradedAt, or at the transaction time if it is nil.
+// Callers check that trainerID may grade.
+func (t *SimpleChaincode) setVlabResult(stub shim.ChaincodeStubInterface, trainerID string, traineeID string, vlabID string, vlabResult string, timeSpent string, gradedAt *time.Time) pb.Response {
 
 	// Retrieve trainee from the ledger
 	traineeBytes, err := stub.GetState(traineeID)
@@ -454,6 +788,9 @@ func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []
 	if _, exists := trainee.VlabPointsMap2[vlabID]; !exists {
 		return shim.Error("Trainee does not have that vlabID")
 	}
+	if vlabResult == "" && trainee.VlabPointsMap2[vlabID].Result == "" {
+		return shim.Error("Vlab has not been scored")
+	}
 
 
 	// Retrieve the Vlab from the ledger
@@ -472,9 +809,56 @@ func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []
 		return shim.Error("Failed to unmarshal Vlab JSON")
 	}
 
+	completedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if gradedAt != nil {
+		completedAt = *gradedAt
+	}
+
+	rules, err := getScoringRulesRecord(stub, trainee.ActivePlatform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Criterion scores are turned into the result through the vlab's rubric
+	vlabResult, criterionScores, err := rubricResult(&vlab, rules, vlabResult)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Keep the assignment window and check the grading time against it
+	assigned := trainee.VlabPointsMap2[vlabID]
+	vlab.StartTime = assigned.StartTime
+	vlab.Deadline = assigned.Deadline
+	vlab.TokensMinted = assigned.TokensMinted
+	// A result that is changed or cleared stays in the season it was scored in
+	if assigned.Result != "" {
+		vlab.ClosedSeason = assigned.ClosedSeason
+	}
+	if vlabResult != "" {
+		if vlab.StartTime != nil && completedAt.Before(*vlab.StartTime) {
+			return shim.Error("Vlab has not started yet")
+		}
+		if rules.HardCutoff && vlab.Deadline != nil && completedAt.After(*vlab.Deadline) {
+			return shim.Error("The deadline of the vlab has passed")
+		}
+		vlab.GradedAt = &completedAt
+	}
+
 	// Update trainee's vlab points
+	previous := trainee
+	resultBefore := assigned.Result
 	vlab.Result = vlabResult
-	trainee.VlabPointsMap2[vlabID] = vlab
+	vlab.CriterionScores = criterionScores
+	vlab.TimeSpent = timeSpent
+
+	// Derive the points from the platform's scoring rules
+	vlab.AwardedPoints, err = rules.award(vlab)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Get the trainee's platform from the ledger
 	platformBytes, err := stub.GetState(trainee.ActivePlatform)
@@ -490,13 +874,88 @@ func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []
 		return shim.Error(err.Error())
 	}
 
-	for i, trainee := range platform.Trainees {
-		if trainee.TraineeID == traineeID {
+	// Results recorded during a competition count for it, and its dynamic
+	// scoring may change the points
+	err = recordEventSolves(stub, &trainee, &platform, &vlab, rules)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Mint reward tokens for points the result earned beyond earlier ones
+	minted, err := mintVlabTokens(stub, &trainee, &vlab)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	trainee.VlabPointsMap2[vlabID] = vlab
+	if vlabResult != "" {
+		trainee.LastCompletion = completedAt
+	}
+
+	// Keep the total in step with the results
+	err = recalculateExpPoints(stub, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for i := range platform.Trainees {
+		if platform.Trainees[i].TraineeID == traineeID {
 			platform.Trainees[i].VlabPointsMap2[vlabID] = vlab
+			platform.Trainees[i].LastCompletion = trainee.LastCompletion
+			setExpPoints(&platform.Trainees[i], trainee.TotalExpPoints)
+			platform.Trainees[i].Level = trainee.Level
 			break
 		}
 	}
 
+	// The completion time breaks ties on the leaderboard
+	err = updateLeaderboard(stub, &previous, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabScoredEventType, VlabScoredEvent{
+		TrainerID:     trainerID,
+		TraineeID:     traineeID,
+		VlabID:        vlabID,
+		PlatformID:    trainee.ActivePlatform,
+		ResultBefore:  resultBefore,
+		ResultAfter:   vlabResult,
+		AwardedPoints: vlab.AwardedPoints,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitExpPointsChange(stub, &previous, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The mint follows the result it was minted for in the event batch
+	err = logMint(stub, trainerID, &trainee, vlabID, minted)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Award the badges the new result earned
+	err = awardBadges(stub, &trainee, &platform, rules)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Completing the platform's catalogue earns its certificate
+	err = issueCertificate(stub, &trainee, &platform, rules)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Passing a step of a learning path assigns the next one
+	pathVlabs, err := syncLearningPaths(stub, &trainee, &platform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	updatedTraineeJSON, err := json.Marshal(trainee)
 	if err != nil {
 		return shim.Error("Failed to marshal updated trainee to JSON")
@@ -508,6 +967,16 @@ func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []
 		return shim.Error(err.Error())
 	}
 
+	// Keep the grade and any new assignments in the trainee's transcript
+	err = updateTranscript(stub, traineeID, func(transcript *Transcript, at time.Time) {
+		transcript.grade(vlab, trainee.ActivePlatform, trainerID, at)
+		for _, pathVlab := range pathVlabs {
+			transcript.assign(pathVlab, trainee.ActivePlatform, at)
+		}
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Convert the updated platform to JSON
 	updatedPlatformJSON, err := json.Marshal(platform)
@@ -524,6 +993,9 @@ func (t *SimpleChaincode) ScoreTheVlab(stub shim.ChaincodeStubInterface, args []
 	return shim.Success(nil)
 }
 
+// getAllAsset scans the whole world state in one response.
+//
+// Deprecated: use the paginated list functions (listTrainees, listPlatforms, ...)
 func (t *SimpleChaincode) getAllAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	// Retrieve all assets from the ledger
 	resultsIterator, err := stub.GetStateByRange("", "")
@@ -585,6 +1057,7 @@ func (t *SimpleChaincode) createVlab(stub shim.ChaincodeStubInterface, args []st
 
 	// Create a new Vlab instance
 	vlab := Vlab{
+		DocType: vlabObjectType,
 		VlabID: vlabID,
 		BoxName:  boxName,
 		Domain: domain,
@@ -607,19 +1080,57 @@ func (t *SimpleChaincode) createVlab(stub shim.ChaincodeStubInterface, args []st
 		return shim.Error(err.Error())
 	}
 
+	// Record the vlab in its type index
+	err = putObjectIndex(stub, vlabObjectType, vlabID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabCreatedEventType, VlabCreatedEvent{
+		VlabOwnerID: vlabOwnerId,
+		VlabID:      vlabID,
+		Vlab:        vlab,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
+// addVlabToTrainee assigns a vlab to a trainee. The optional start time
+// and deadline are RFC3339 timestamps; either may be left empty.
+// Arguments: traineeID, vlabID, optional startTime, optional deadline
 func (t *SimpleChaincode) addVlabToTrainee(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	// Check the number of arguments
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting traineeID and vlabID")
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID, vlabID, optional startTime and optional deadline")
 	}
 
 	// Extract the traineeID and vlabID from arguments
 	traineeID := args[0]
 	vlabID := args[1]
 
+	// Parse the assignment window
+	var startTime, deadline *time.Time
+	if len(args) > 2 && args[2] != "" {
+		parsed, err := time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error("startTime must be an RFC3339 timestamp")
+		}
+		startTime = &parsed
+	}
+	if len(args) > 3 && args[3] != "" {
+		parsed, err := time.Parse(time.RFC3339, args[3])
+		if err != nil {
+			return shim.Error("deadline must be an RFC3339 timestamp")
+		}
+		deadline = &parsed
+	}
+	if startTime != nil && deadline != nil && !deadline.After(*startTime) {
+		return shim.Error("deadline must be after startTime")
+	}
+
 	// Get the existing trainee from the ledger
 	traineeBytes, err := stub.GetState(traineeID)
 	if err != nil {
@@ -683,7 +1194,18 @@ func (t *SimpleChaincode) addVlabToTrainee(stub shim.ChaincodeStubInterface, arg
 		return shim.Error("Vlab with ID "+vlabID+" already exists for trainee with ID "+ vlabID)
 	}
 
+	// Check that the trainee passed every prerequisite of the vlab
+	missing, err := missingPrerequisites(stub, &trainee, &vlab)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(missing) > 0 {
+		return shim.Error("Trainee with ID "+traineeID+" has not passed the prerequisites "+strings.Join(missing, ", ")+" of vlab "+vlabID)
+	}
+
 	// Add the Vlab to the Trainee's VlabPointsMap
+	vlab.StartTime = startTime
+	vlab.Deadline = deadline
 	trainee.VlabPointsMap2[vlabID] = vlab
 
 
@@ -707,6 +1229,25 @@ func (t *SimpleChaincode) addVlabToTrainee(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(err.Error())
 	}
 
+	// Record the attempt in the trainee's transcript
+	err = updateTranscript(stub, traineeID, func(transcript *Transcript, at time.Time) {
+		transcript.assign(vlab, trainee.ActivePlatform, at)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabAssignedEventType, VlabAssignedEvent{
+		TraineeID:  traineeID,
+		VlabID:     vlabID,
+		PlatformID: trainee.ActivePlatform,
+		StartTime:  startTime,
+		Deadline:   deadline,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 
 	// Convert the updated platform to JSON
 	updatedPlatformJSON, err := json.Marshal(platform)
@@ -783,6 +1324,7 @@ func (t *SimpleChaincode) deleteTraineeFromPlatform(stub shim.ChaincodeStubInter
 	platform.Trainees = updatedTrainees
 
 	// Update the trainee's active platform to empty
+	previous := trainee
 	trainee.ActivePlatform = ""
 
 	// Convert trainee object to JSON
@@ -797,6 +1339,35 @@ func (t *SimpleChaincode) deleteTraineeFromPlatform(stub shim.ChaincodeStubInter
 		return shim.Error(err.Error())
 	}
 
+	// Remove the trainee from the platform's leaderboard
+	err = updateLeaderboard(stub, &previous, nil)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Close the platform membership in the trainee's transcript
+	err = updateTranscript(stub, traineeID, func(transcript *Transcript, at time.Time) {
+		transcript.leave(platformID, at)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TraineeRemovedFromPlatformEventType, TraineeRemovedFromPlatformEvent{
+		AdministratorID: administratorID,
+		TraineeID:       traineeID,
+		PlatformID:      platformID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Leaving the platform also leaves its team
+	err = leaveTeam(stub, administratorID, platformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Convert platform object to JSON
 	updatedPlatformJSON, err := json.Marshal(platform)
 	if err != nil {
@@ -837,6 +1408,7 @@ func (t *SimpleChaincode) createAdministrator(stub shim.ChaincodeStubInterface,
 
 	// Create a new Administrator object
 	administrator := Administrator{
+		DocType:			administratorObjectType,
 		AdministratorID:    administratorID,
 		FirstName:    		firstName,
 		LastName: 			lastName,
@@ -858,6 +1430,20 @@ func (t *SimpleChaincode) createAdministrator(stub shim.ChaincodeStubInterface,
 		return shim.Error(err.Error())
 	}
 
+	// Record the administrator in its type index
+	err = putObjectIndex(stub, administratorObjectType, administratorID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, AdministratorCreatedEventType, AdministratorCreatedEvent{
+		AdministratorID: administratorID,
+		Administrator:   administrator,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -887,6 +1473,7 @@ func (t *SimpleChaincode) createVlabOwner(stub shim.ChaincodeStubInterface, args
 
 	// Create a new VlabOwner object
 	vlabOwner := VlabOwner{
+		DocType:			vlabOwnerObjectType,
 		VLabOwnerID:     	vlabOwnerID,
 		FirstName:    		firstName,
 		LastName: 			lastName,
@@ -908,6 +1495,20 @@ func (t *SimpleChaincode) createVlabOwner(stub shim.ChaincodeStubInterface, args
 		return shim.Error(err.Error())
 	}
 
+	// Record the vlab owner in its type index
+	err = putObjectIndex(stub, vlabOwnerObjectType, vlabOwnerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabOwnerCreatedEventType, VlabOwnerCreatedEvent{
+		VlabOwnerID: vlabOwnerID,
+		VlabOwner:   vlabOwner,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -978,6 +1579,15 @@ func (t *SimpleChaincode) addVlabToPlatform(stub shim.ChaincodeStubInterface, ar
 		return shim.Error(err.Error())
 	}
 
+	err = emitEvent(stub, VlabAddedToPlatformEventType, VlabAddedToPlatformEvent{
+		AdministratorID: administratorID,
+		VlabID:          vlabID,
+		PlatformID:      PlatformID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	return shim.Success(nil)
 }
 
@@ -1015,6 +1625,7 @@ func (t *SimpleChaincode) TransferTrainee1(stub shim.ChaincodeStubInterface, arg
 
 	// Get the current platform of the trainee
 	currentPlatformID := trainee.ActivePlatform
+	previous := trainee
 
 	
 	// Retrieve the current platform from the ledger
@@ -1057,11 +1668,21 @@ func (t *SimpleChaincode) TransferTrainee1(stub shim.ChaincodeStubInterface, arg
 	commonVLabs := findCommonVLabs(trainee.VlabPointsMap2, newPlatform.Vlabs)
 
 	// Remove non-common VLabs from trainee's VlabPointsMap2
+	droppedVLabs := []string{}
 	for vlabID := range trainee.VlabPointsMap2 {
 		if !contains(commonVLabs, vlabID) {
 			delete(trainee.VlabPointsMap2, vlabID)
+			droppedVLabs = append(droppedVLabs, vlabID)
 		}
 	}
+	// Map order differs between peers; the transcript and event need one order
+	sort.Strings(droppedVLabs)
+
+	// Results of the dropped vlabs no longer count
+	err = recalculateExpPoints(stub, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Remove the trainee from the current platform
 	for i, trainee := range currentPlatform.Trainees {
@@ -1098,6 +1719,46 @@ func (t *SimpleChaincode) TransferTrainee1(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(err.Error())
 	}
 
+	// Move the trainee to the new platform's leaderboard
+	err = updateLeaderboard(stub, &previous, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Keep the move and the dropped vlabs in the trainee's transcript
+	err = updateTranscript(stub, traineeID, func(transcript *Transcript, at time.Time) {
+		for _, vlabID := range droppedVLabs {
+			transcript.remove(vlabID, at)
+		}
+		transcript.leave(currentPlatformID, at)
+		transcript.join(newPlatformID, at)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TraineeTransferredEventType, TraineeTransferredEvent{
+		AdministratorID: administratorID,
+		TraineeID:       traineeID,
+		FromPlatformID:  currentPlatformID,
+		ToPlatformID:    newPlatformID,
+		DroppedVlabIDs:  droppedVLabs,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitExpPointsChange(stub, &previous, &trainee)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Leaving the platform also leaves its team
+	err = leaveTeam(stub, administratorID, currentPlatformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Convert current platform object to JSON
 	currentPlatformJSON, err := json.Marshal(currentPlatform)
 	if err != nil {
@@ -1145,6 +1806,82 @@ func findCommonVLabs(traineeVLabs map[string]Vlab, platformVLabs []Vlab) []strin
 	return commonVLabs
 }
 
+// Helper function to read a trainee from the ledger
+func getTraineeRecord(stub shim.ChaincodeStubInterface, traineeID string) (*Trainee, error) {
+	traineeBytes, err := stub.GetState(traineeID)
+	if err != nil {
+		return nil, err
+	}
+	if traineeBytes == nil {
+		return nil, fmt.Errorf("Trainee does not exist")
+	}
+
+	trainee := &Trainee{}
+	err = json.Unmarshal(traineeBytes, trainee)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal trainee JSON")
+	}
+	return trainee, nil
+}
+
+// Helper function to get the transaction timestamp as a time.Time
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return txTimestamp.AsTime(), nil
+}
+
+// Helper function to set both representations of a trainee's experience points
+func setExpPoints(trainee *Trainee, expPoints int) {
+	trainee.Total_Exp_Points = strconv.Itoa(expPoints)
+	trainee.TotalExpPoints = expPoints
+}
+
+// Helper function to recompute a trainee's experience points from the
+// points carried over and those awarded for the trainee's vlabs of the
+// current season, and the level that goes with them
+func recalculateExpPoints(stub shim.ChaincodeStubInterface, trainee *Trainee) error {
+	// Results recorded before awarded points existed still count
+	_, err := backfillAwardedPoints(stub, trainee)
+	if err != nil {
+		return err
+	}
+
+	// Points of vlabs scored in a closed season, even when they change
+	// later, count in that season only
+	expPoints := trainee.CarriedOver
+	for _, vlab := range trainee.VlabPointsMap2 {
+		if vlab.ClosedSeason == 0 {
+			expPoints += vlab.AwardedPoints
+		}
+	}
+
+	setExpPoints(trainee, expPoints)
+	return setLevel(stub, trainee)
+}
+
+// Helper function to emit ExpPointsRecalculated if a trainee's total changed,
+// and LevelUp if the trainee reached a higher level
+func emitExpPointsChange(stub shim.ChaincodeStubInterface, previous *Trainee, current *Trainee) error {
+	if previous.TotalExpPoints == current.TotalExpPoints && previous.Total_Exp_Points == current.Total_Exp_Points {
+		return nil
+	}
+
+	err := emitEvent(stub, ExpPointsRecalculatedEventType, ExpPointsRecalculatedEvent{
+		TraineeID:  current.TraineeID,
+		PlatformID: current.ActivePlatform,
+		Before:     previous.TotalExpPoints,
+		After:      current.TotalExpPoints,
+	})
+	if err != nil {
+		return err
+	}
+
+	return emitLevelUp(stub, previous, current)
+}
+
 // Helper function to check if a string slice contains a given string
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
@@ -1157,94 +1894,150 @@ func contains(slice []string, str string) bool {
 
 
 
+// calculateExpPoints is an administrator repair tool that re-scores the vlab
+// results of a platform's trainees under the platform's current scoring rules
+// and recomputes their experience points. Scoring keeps the totals current,
+// so it is only needed after the rules change or for data written before.
+// It handles up to limit trainees starting at startTraineeID (empty for the
+// first) and returns the trainee to continue from, or empty when done.
+// Arguments: administratorID, platformID, startTraineeID, limit
 func (t *SimpleChaincode) calculateExpPoints(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID, startTraineeID and limit")
 	}
 
-	traineeID := args[0]
+	administratorID := args[0]
+	platformID := args[1]
+	startTraineeID := args[2]
+	limit, err := strconv.Atoi(args[3])
+	if err != nil || limit <= 0 {
+		return shim.Error("limit must be a positive integer")
+	}
 
-	// Retrieve trainee from the ledger
-	traineeBytes, err := stub.GetState(traineeID)
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	// Retrieve the platform from the ledger
+	platformBytes, err := stub.GetState(platformID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	if traineeBytes == nil {
-		return shim.Error("Trainee does not exist")
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
 	}
 
-	// Unmarshal trainee JSON
-	trainee := Trainee{}
-	err = json.Unmarshal(traineeBytes, &trainee)
+	// Unmarshal the platform JSON
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
 	if err != nil {
-		return shim.Error("Failed to unmarshal trainee JSON")
+		return shim.Error("Failed to unmarshal platform JSON")
 	}
 
-	// Calculate the total experience points
-	expPoints := 0
-	for _, vlab := range trainee.VlabPointsMap2 {
-		if vlab.Result != "" {
-			// Convert the result to an integer and add it to expPoints
-			result, err := strconv.Atoi(vlab.Result)
-			if err != nil {
-				return shim.Error("Failed to convert vlab result to integer")
+	rules, err := getScoringRulesRecord(stub, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Find where this page starts in the platform's trainees
+	start := 0
+	if startTraineeID != "" {
+		start = -1
+		for i, trainee := range platform.Trainees {
+			if trainee.TraineeID == startTraineeID {
+				start = i
+				break
 			}
-			expPoints += result
+		}
+		if start < 0 {
+			return shim.Error("Trainee " + startTraineeID + " is not on platform " + platformID)
 		}
 	}
 
-	// Update the trainee's experience points
-	trainee.Total_Exp_Points = strconv.Itoa(expPoints)
-
-	// Convert trainee object to JSON
-	updatedTraineeJSON, err := json.Marshal(trainee)
-	if err != nil {
-		return shim.Error("Failed to marshal updated trainee to JSON")
+	end := start + limit
+	nextTraineeID := ""
+	if end < len(platform.Trainees) {
+		nextTraineeID = platform.Trainees[end].TraineeID
+	} else {
+		end = len(platform.Trainees)
 	}
 
+	for i := start; i < end; i++ {
+		traineeID := platform.Trainees[i].TraineeID
 
+		// Retrieve trainee from the ledger
+		traineeBytes, err := stub.GetState(traineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if traineeBytes == nil {
+			return shim.Error("Trainee " + traineeID + " does not exist")
+		}
 
-	// Get the trainee's platform from the ledger
-	platformBytes, err := stub.GetState(trainee.ActivePlatform)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
+		// Unmarshal trainee JSON
+		trainee := Trainee{}
+		err = json.Unmarshal(traineeBytes, &trainee)
+		if err != nil {
+			return shim.Error("Failed to unmarshal trainee JSON")
+		}
 
+		// Re-score the results and update the trainee's experience points
+		previous := trainee
+		vlabs := map[string]Vlab{}
+		for vlabID, vlab := range trainee.VlabPointsMap2 {
+			vlab.AwardedPoints, err = awardVlab(stub, rules, traineeID, vlab)
+			if err != nil {
+				return shim.Error("Trainee " + traineeID + ": " + err.Error())
+			}
+			vlabs[vlabID] = vlab
+		}
+		trainee.VlabPointsMap2 = vlabs
+		err = recalculateExpPoints(stub, &trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		platform.Trainees[i].VlabPointsMap2 = trainee.VlabPointsMap2
+		setExpPoints(&platform.Trainees[i], trainee.TotalExpPoints)
+		platform.Trainees[i].Level = trainee.Level
 
-	// Unmarshal the platform JSON
-	var platform Platform
-	err = json.Unmarshal(platformBytes, &platform)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
+		// Convert trainee object to JSON
+		updatedTraineeJSON, err := json.Marshal(trainee)
+		if err != nil {
+			return shim.Error("Failed to marshal updated trainee to JSON")
+		}
 
-	for i, trainee := range platform.Trainees {
-		if trainee.TraineeID == traineeID {
-			platform.Trainees[i].Total_Exp_Points = strconv.Itoa(expPoints)
-			break
+		// Save updated trainee JSON to the ledger
+		err = stub.PutState(traineeID, updatedTraineeJSON)
+		if err != nil {
+			return shim.Error(err.Error())
 		}
-	}
 
+		// Re-rank the trainee with the new points
+		err = updateLeaderboard(stub, &previous, &trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 
-	// Convert the updated platform to JSON
-	updatedPlatformJSON, err := json.Marshal(platform)
-	if err != nil {
-		return shim.Error(err.Error())
+		err = emitExpPointsChange(stub, &previous, &trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
 
-	// Store the updated trainee in the ledger
-	err = stub.PutState(trainee.ActivePlatform, updatedPlatformJSON)
+	// Convert the updated platform to JSON
+	updatedPlatformJSON, err := json.Marshal(platform)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Save updated trainee JSON to the ledger
-	err = stub.PutState(traineeID, updatedTraineeJSON)
+	// Store the updated platform in the ledger
+	err = stub.PutState(platformID, updatedPlatformJSON)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	return shim.Success(nil)
+	return shim.Success([]byte(nextTraineeID))
 }
 
 
@@ -0,0 +1,144 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// putLegacyResult stores a result of v1 the way it was stored before
+// scoring rules, when the result was the points themselves
+func putLegacyResult(t *testing.T, stub *testStub, traineeID string, result string) {
+	t.Helper()
+	trainee := Trainee{}
+	getTestState(t, stub, traineeID, &trainee)
+	vlab := trainee.VlabPointsMap2["v1"]
+	vlab.Result = result
+	vlab.AwardedPoints = 0
+	trainee.VlabPointsMap2["v1"] = vlab
+	trainee.Total_Exp_Points = result
+	putTestState(t, stub, traineeID, trainee)
+}
+
+func TestCalculateExpPointsKeepsLegacyResults(t *testing.T) {
+	stub := newTestPlatform(t)
+	putLegacyResult(t, stub, "t1", "150")
+	putLegacyResult(t, stub, "t2", "80")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t3", "v1", "50")
+
+	next := mustInvoke(t, stub, "calculateExpPoints", "admin1", "p1", "", "10")
+	if len(next) != 0 {
+		t.Fatalf("next trainee = %q, want none", next)
+	}
+
+	platform := Platform{}
+	getTestState(t, stub, "p1", &platform)
+	copies := map[string]Trainee{}
+	for _, trainee := range platform.Trainees {
+		copies[trainee.TraineeID] = trainee
+	}
+
+	tests := []struct {
+		traineeID string
+		points    int
+	}{
+		// Not a percentage, so the points it always counted for
+		{"t1", 150},
+		// A percentage of the 100 points of v1
+		{"t2", 80},
+		{"t3", 50},
+	}
+	for _, test := range tests {
+		trainee := Trainee{}
+		getTestState(t, stub, test.traineeID, &trainee)
+		if trainee.TotalExpPoints != test.points || trainee.Total_Exp_Points != fmt.Sprint(test.points) {
+			t.Errorf("%s: total = %d/%q, want %d", test.traineeID, trainee.TotalExpPoints, trainee.Total_Exp_Points, test.points)
+		}
+		if awarded := trainee.VlabPointsMap2["v1"].AwardedPoints; awarded != test.points {
+			t.Errorf("%s: awarded points of v1 = %d, want %d", test.traineeID, awarded, test.points)
+		}
+		if copied := copies[test.traineeID].TotalExpPoints; copied != test.points {
+			t.Errorf("%s: platform copy total = %d, want %d", test.traineeID, copied, test.points)
+		}
+	}
+}
+
+func TestRecalculateExpPoints(t *testing.T) {
+	stub := newTestStub()
+	rulesKey, err := stub.CreateCompositeKey(scoringRulesObjectType, []string{"p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passFail := defaultScoringRules("p2")
+	passFail.ResultType = PassFailResultType
+	putTestState(t, stub, rulesKey, passFail)
+	gradedAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		platformID  string
+		carriedOver int
+		vlabs       []Vlab
+		points      int
+		level       string
+	}{
+		{"no vlabs", "p1", 0, nil, 0, "Novice"},
+		{"current season", "p1", 0, []Vlab{
+			{VlabID: "v1", ExpPoints: "100", Result: "80", GradedAt: &gradedAt, AwardedPoints: 80},
+			{VlabID: "v2", ExpPoints: "500", Result: "100", GradedAt: &gradedAt, AwardedPoints: 500},
+		}, 580, "Apprentice"},
+		{"closed season", "p1", 0, []Vlab{
+			{VlabID: "v1", ExpPoints: "100", Result: "80", GradedAt: &gradedAt, AwardedPoints: 80, ClosedSeason: 1},
+			{VlabID: "v2", ExpPoints: "500", Result: "100", GradedAt: &gradedAt, AwardedPoints: 500},
+		}, 500, "Apprentice"},
+		{"carried over", "p1", 40, []Vlab{
+			{VlabID: "v1", ExpPoints: "100", Result: "80", GradedAt: &gradedAt, AwardedPoints: 80, ClosedSeason: 1},
+			{VlabID: "v2", ExpPoints: "500", Result: "100", GradedAt: &gradedAt, AwardedPoints: 100},
+		}, 140, "Novice"},
+		{"only carried over", "p1", 2500, []Vlab{
+			{VlabID: "v1", ExpPoints: "100", Result: "80", GradedAt: &gradedAt, AwardedPoints: 80, ClosedSeason: 2},
+		}, 2500, "Hacker"},
+		// Results recorded before awarded points were the points themselves
+		{"legacy percentage", "p1", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "80"}}, 80, "Novice"},
+		{"legacy points", "p1", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "150"}}, 150, "Novice"},
+		{"legacy pass", "p2", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "pass"}}, 100, "Novice"},
+		{"legacy points on pass/fail platform", "p2", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "150"}}, 150, "Novice"},
+		{"legacy text", "p1", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "done"}}, 0, "Novice"},
+		{"legacy result in closed season", "p1", 10, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "150", ClosedSeason: 1}}, 10, "Novice"},
+		{"graded result rules reject", "p1", 0, []Vlab{{VlabID: "v1", ExpPoints: "100", Result: "150", GradedAt: &gradedAt}}, 0, "Novice"},
+	}
+	for _, test := range tests {
+		trainee := &Trainee{TraineeID: "t1", ActivePlatform: test.platformID, CarriedOver: test.carriedOver, VlabPointsMap2: map[string]Vlab{}}
+		for _, vlab := range test.vlabs {
+			trainee.VlabPointsMap2[vlab.VlabID] = vlab
+		}
+
+		err := recalculateExpPoints(stub, trainee)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if trainee.TotalExpPoints != test.points || trainee.Total_Exp_Points != fmt.Sprint(test.points) {
+			t.Errorf("%s: total = %d/%q, want %d", test.name, trainee.TotalExpPoints, trainee.Total_Exp_Points, test.points)
+		}
+		if trainee.Level != test.level {
+			t.Errorf("%s: level = %s, want %s", test.name, trainee.Level, test.level)
+		}
+	}
+}
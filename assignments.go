@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// OverdueAssignment is an unscored vlab whose deadline has passed
+type OverdueAssignment struct {
+	TraineeID    string
+	Nickname     string
+	VlabID       string
+	BoxName      string
+	Deadline     time.Time
+	HoursOverdue float64
+}
+
+// listOverdueAssignments returns the assignments of a platform's trainees
+// that have no result and whose deadline lies before the time of the query,
+// oldest deadline first.
+// Arguments: platformID
+func (t *SimpleChaincode) listOverdueAssignments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	platformID := args[0]
+
+	// Retrieve the platform from the ledger
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+
+	// Unmarshal the platform JSON
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error("Failed to unmarshal platform JSON")
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	overdue := []OverdueAssignment{}
+	for _, trainee := range platform.Trainees {
+		for _, vlab := range trainee.VlabPointsMap2 {
+			if vlab.Result != "" || vlab.Deadline == nil || !now.After(*vlab.Deadline) {
+				continue
+			}
+			overdue = append(overdue, OverdueAssignment{
+				TraineeID:    trainee.TraineeID,
+				Nickname:     trainee.Nickname,
+				VlabID:       vlab.VlabID,
+				BoxName:      vlab.BoxName,
+				Deadline:     *vlab.Deadline,
+				HoursOverdue: now.Sub(*vlab.Deadline).Hours(),
+			})
+		}
+	}
+
+	sort.Slice(overdue, func(i, j int) bool {
+		if !overdue[i].Deadline.Equal(overdue[j].Deadline) {
+			return overdue[i].Deadline.Before(overdue[j].Deadline)
+		}
+		if overdue[i].TraineeID != overdue[j].TraineeID {
+			return overdue[i].TraineeID < overdue[j].TraineeID
+		}
+		return overdue[i].VlabID < overdue[j].VlabID
+	})
+
+	overdueJSON, err := json.Marshal(overdue)
+	if err != nil {
+		return shim.Error("Failed to marshal overdue assignments to JSON")
+	}
+
+	return shim.Success(overdueJSON)
+}
@@ -0,0 +1,411 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Badges live under three composite keys
+//
+//	badge \x00 badgeID \x00                        the definition
+//	badgeaward \x00 traineeID \x00 badgeID \x00    the award, owned by the trainee
+//	badgeholder \x00 badgeID \x00 traineeID \x00   the same award, indexed by badge
+//
+// An award is bound to its trainee by its key and no function moves it, so
+// badges cannot be transferred. Awards are never taken back, even if the
+// results that earned them change later.
+const (
+	badgeObjectType       = "badge"
+	badgeAwardObjectType  = "badgeaward"
+	badgeHolderObjectType = "badgeholder"
+)
+
+// Badge rule types
+const (
+	// CompleteCountRule is met by completing Count vlabs, optionally only
+	// those of Domain and BoxDifficulty
+	CompleteCountRule = "completeCount"
+	// CompletePlatformRule is met by completing every vlab of PlatformID, or
+	// of the trainee's active platform if PlatformID is empty
+	CompletePlatformRule = "completePlatform"
+)
+
+// BadgeRule decides when a badge is earned. A vlab counts as completed once
+// it has a passing result under the scoring rules of the trainee's platform.
+type BadgeRule struct {
+	Type          string
+	Count         int    `json:"Count,omitempty"`
+	Domain        string `json:"Domain,omitempty"`
+	BoxDifficulty string `json:"BoxDifficulty,omitempty"`
+	PlatformID    string `json:"PlatformID,omitempty"`
+}
+
+// Badge is a badge definition
+type Badge struct {
+	DocType     string `json:"docType"`
+	BadgeID     string
+	Name        string
+	Description string
+	Rule        BadgeRule
+	CreatedBy   string
+}
+
+// BadgeAward is a badge held by a trainee
+type BadgeAward struct {
+	DocType    string `json:"docType"`
+	BadgeID    string
+	TraineeID  string
+	Name       string
+	PlatformID string
+	AwardedAt  time.Time
+}
+
+// validate checks a rule submitted by an administrator
+func (rule *BadgeRule) validate() error {
+	switch rule.Type {
+	case CompleteCountRule:
+		if rule.Count <= 0 {
+			return fmt.Errorf("Count must be a positive integer")
+		}
+	case CompletePlatformRule:
+	default:
+		return fmt.Errorf("Rule type must be %s or %s", CompleteCountRule, CompletePlatformRule)
+	}
+	return nil
+}
+
+// completedCatalogue reports whether a trainee passed every vlab of a
+// platform under its scoring rules
+func completedCatalogue(trainee *Trainee, platform *Platform, rules *ScoringRules) bool {
+	if len(platform.Vlabs) == 0 {
+		return false
+	}
+	for _, platformVlab := range platform.Vlabs {
+		vlab, exists := trainee.VlabPointsMap2[platformVlab.VlabID]
+		if !exists || !rules.passes(vlab) {
+			return false
+		}
+	}
+	return true
+}
+
+// met reports whether a trainee meets the rule. platform is the trainee's
+// active platform and rules are its scoring rules.
+func (rule *BadgeRule) met(trainee *Trainee, platform *Platform, rules *ScoringRules) bool {
+	switch rule.Type {
+	case CompleteCountRule:
+		count := 0
+		for _, vlab := range trainee.VlabPointsMap2 {
+			if !rules.passes(vlab) {
+				continue
+			}
+			if rule.Domain != "" && vlab.Domain != rule.Domain {
+				continue
+			}
+			if rule.BoxDifficulty != "" && vlab.BoxDifficulty != rule.BoxDifficulty {
+				continue
+			}
+			count++
+		}
+		return count >= rule.Count
+
+	case CompletePlatformRule:
+		if rule.PlatformID != "" && rule.PlatformID != platform.PlatformID {
+			return false
+		}
+		return completedCatalogue(trainee, platform, rules)
+	}
+	return false
+}
+
+// getBadgeRecord reads a badge definition, or nil if it does not exist
+func getBadgeRecord(stub shim.ChaincodeStubInterface, badgeID string) (*Badge, error) {
+	badgeKey, err := stub.CreateCompositeKey(badgeObjectType, []string{badgeID})
+	if err != nil {
+		return nil, err
+	}
+
+	badgeBytes, err := stub.GetState(badgeKey)
+	if err != nil {
+		return nil, err
+	}
+	if badgeBytes == nil {
+		return nil, nil
+	}
+
+	badge := &Badge{}
+	err = json.Unmarshal(badgeBytes, badge)
+	if err != nil {
+		return nil, err
+	}
+	return badge, nil
+}
+
+// awardBadges gives a trainee every badge whose rule the trainee now meets
+// and does not hold yet. rules are the scoring rules of the trainee's
+// platform.
+func awardBadges(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform, rules *ScoringRules) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(badgeObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	awardedAt, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		badge := Badge{}
+		err = json.Unmarshal(queryResult.Value, &badge)
+		if err != nil {
+			return err
+		}
+		if !badge.Rule.met(trainee, platform, rules) {
+			continue
+		}
+
+		awardKey, err := stub.CreateCompositeKey(badgeAwardObjectType, []string{trainee.TraineeID, badge.BadgeID})
+		if err != nil {
+			return err
+		}
+		awardBytes, err := stub.GetState(awardKey)
+		if err != nil {
+			return err
+		}
+		if awardBytes != nil {
+			continue
+		}
+
+		award := BadgeAward{
+			DocType:    badgeAwardObjectType,
+			BadgeID:    badge.BadgeID,
+			TraineeID:  trainee.TraineeID,
+			Name:       badge.Name,
+			PlatformID: platform.PlatformID,
+			AwardedAt:  awardedAt,
+		}
+		awardJSON, err := json.Marshal(award)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(awardKey, awardJSON)
+		if err != nil {
+			return err
+		}
+
+		holderKey, err := stub.CreateCompositeKey(badgeHolderObjectType, []string{badge.BadgeID, trainee.TraineeID})
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(holderKey, awardJSON)
+		if err != nil {
+			return err
+		}
+
+		err = emitEvent(stub, BadgeAwardedEventType, BadgeAwardedEvent{
+			BadgeID:    badge.BadgeID,
+			TraineeID:  trainee.TraineeID,
+			PlatformID: platform.PlatformID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createBadge defines a new badge. Trainees earn it the next time one of
+// their results is recorded.
+// Arguments: administratorID, badgeID, name, description, rule JSON
+// e.g. {"Type":"completeCount","Count":5,"Domain":"Web"}
+func (t *SimpleChaincode) createBadge(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, badgeID, name, description and rule")
+	}
+
+	administratorID := args[0]
+	badgeID := args[1]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+	if badgeID == "" {
+		return shim.Error("badgeID must not be empty")
+	}
+
+	// Check if Badge already exists
+	existing, err := getBadgeRecord(stub, badgeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Badge already exists")
+	}
+
+	rule := BadgeRule{}
+	err = json.Unmarshal([]byte(args[4]), &rule)
+	if err != nil {
+		return shim.Error("Failed to unmarshal badge rule JSON")
+	}
+	err = rule.validate()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	badge := Badge{
+		DocType:     badgeObjectType,
+		BadgeID:     badgeID,
+		Name:        args[2],
+		Description: args[3],
+		Rule:        rule,
+		CreatedBy:   administratorID,
+	}
+
+	badgeJSON, err := json.Marshal(badge)
+	if err != nil {
+		return shim.Error("Failed to marshal badge to JSON")
+	}
+
+	badgeKey, err := stub.CreateCompositeKey(badgeObjectType, []string{badgeID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(badgeKey, badgeJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, BadgeCreatedEventType, BadgeCreatedEvent{
+		AdministratorID: administratorID,
+		Badge:           badge,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// listBadges returns the badges a trainee holds.
+// Arguments: traineeID
+func (t *SimpleChaincode) listBadges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(badgeAwardObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	awards := []BadgeAward{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		award := BadgeAward{}
+		err = json.Unmarshal(queryResult.Value, &award)
+		if err != nil {
+			return shim.Error("Failed to unmarshal badge award JSON")
+		}
+		awards = append(awards, award)
+	}
+
+	awardsJSON, err := json.Marshal(awards)
+	if err != nil {
+		return shim.Error("Failed to marshal badge awards to JSON")
+	}
+
+	return shim.Success(awardsJSON)
+}
+
+// getBadgeHolders returns one page of the trainees holding a badge.
+// Arguments: badgeID, pageSize, optional bookmark
+func (t *SimpleChaincode) getBadgeHolders(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting badgeID, pageSize and optional bookmark")
+	}
+
+	badgeID := args[0]
+	pageSize, bookmark, err := parsePagination(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check if Badge exists
+	badge, err := getBadgeRecord(stub, badgeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if badge == nil {
+		return shim.Error("Badge does not exist")
+	}
+
+	resultsIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(badgeHolderObjectType, []string{badgeID}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []interface{}{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		award := BadgeAward{}
+		err = json.Unmarshal(queryResult.Value, &award)
+		if err != nil {
+			return shim.Error("Failed to unmarshal badge award JSON")
+		}
+		records = append(records, award)
+	}
+
+	result := PaginatedQueryResult{
+		PageSize:            pageSize,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+		Records:             records,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to marshal query result to JSON")
+	}
+
+	return shim.Success(resultJSON)
+}
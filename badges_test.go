@@ -0,0 +1,52 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// badgeIDs returns the IDs of the badges a trainee holds
+func badgeIDs(t *testing.T, stub *testStub, traineeID string) []string {
+	t.Helper()
+	awards := []BadgeAward{}
+	err := json.Unmarshal(mustInvoke(t, stub, "listBadges", traineeID), &awards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badgeIDs := []string{}
+	for _, award := range awards {
+		badgeIDs = append(badgeIDs, award.BadgeID)
+	}
+	return badgeIDs
+}
+
+func TestBadgeNeedsPassingResult(t *testing.T) {
+	stub := newTestPlatform(t)
+	mustInvoke(t, stub, "createBadge", "admin1", "web1", "Web beginner", "First Web box", `{"Type":"completeCount","Count":1,"Domain":"Web"}`)
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "1")
+	if held := badgeIDs(t, stub, "t1"); len(held) != 0 {
+		t.Fatalf("badges after 1%% = %v, want none", held)
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "75")
+	if held := badgeIDs(t, stub, "t1"); len(held) != 1 || held[0] != "web1" {
+		t.Fatalf("badges after 75%% = %v, want [web1]", held)
+	}
+}
@@ -0,0 +1,420 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Certificates live under two composite keys
+//
+//	certificate \x00 certificateID \x00
+//	certificateissued \x00 traineeID \x00 platformID \x00    the certificate ID
+//	certificateissued \x00 traineeID \x00 platformID \x00 pathID \x00
+//
+// A trainee gets one certificate per platform, issued by the transaction
+// that gives the trainee a passing result for every vlab of the platform's
+// catalogue, and one per learning path that asks for it. A revoked
+// certificate is not issued again.
+const (
+	certificateObjectType       = "certificate"
+	certificateIssuedObjectType = "certificateissued"
+)
+
+// Verification statuses returned by verifyCertificate
+const (
+	CertificateValid        = "valid"
+	CertificateRevoked      = "revoked"
+	CertificateHashMismatch = "hashMismatch"
+	CertificateNotFound     = "notFound"
+)
+
+// CertificateVlab is one completed vlab listed on a certificate
+type CertificateVlab struct {
+	VlabID        string
+	BoxName       string
+	Domain        string
+	BoxDifficulty string
+	Result        string
+	AwardedPoints int
+}
+
+// CertificateContent is the part of a certificate covered by its hash
+type CertificateContent struct {
+	CertificateID  string
+	TraineeID      string
+	TraineeName    string
+	PlatformID     string
+	PlatformName   string
+	PathID         string `json:"PathID,omitempty"`
+	PathName       string `json:"PathName,omitempty"`
+	Vlabs          []CertificateVlab
+	TotalExpPoints int
+	IssuedAt       time.Time
+}
+
+// Certificate is a completion certificate. ContentHash is the hex SHA-256 of
+// the JSON encoding of CertificateContent.
+type Certificate struct {
+	DocType string `json:"docType"`
+	CertificateContent
+	ContentHash      string
+	Revoked          bool
+	RevokedAt        *time.Time `json:"RevokedAt,omitempty"`
+	RevokedBy        string     `json:"RevokedBy,omitempty"`
+	RevocationReason string     `json:"RevocationReason,omitempty"`
+}
+
+// CertificateVerification is returned by verifyCertificate
+type CertificateVerification struct {
+	CertificateID    string
+	Status           string
+	HashMatches      bool
+	Revoked          bool
+	RevokedAt        *time.Time   `json:"RevokedAt,omitempty"`
+	RevocationReason string       `json:"RevocationReason,omitempty"`
+	Certificate      *Certificate `json:"Certificate,omitempty"`
+}
+
+// contentHash returns the hex SHA-256 of a certificate's content
+func contentHash(content CertificateContent) (string, error) {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(contentJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// getCertificateRecord reads a certificate, or nil if it does not exist
+func getCertificateRecord(stub shim.ChaincodeStubInterface, certificateID string) (*Certificate, error) {
+	certificateKey, err := stub.CreateCompositeKey(certificateObjectType, []string{certificateID})
+	if err != nil {
+		return nil, err
+	}
+
+	certificateBytes, err := stub.GetState(certificateKey)
+	if err != nil {
+		return nil, err
+	}
+	if certificateBytes == nil {
+		return nil, nil
+	}
+
+	certificate := &Certificate{}
+	err = json.Unmarshal(certificateBytes, certificate)
+	if err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// putCertificate saves a certificate
+func putCertificate(stub shim.ChaincodeStubInterface, certificate *Certificate) error {
+	certificateJSON, err := json.Marshal(certificate)
+	if err != nil {
+		return err
+	}
+
+	certificateKey, err := stub.CreateCompositeKey(certificateObjectType, []string{certificate.CertificateID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(certificateKey, certificateJSON)
+}
+
+// newCertificateID derives a certificate ID that every endorser computes
+// the same way
+func newCertificateID(stub shim.ChaincodeStubInterface, parts ...string) string {
+	hash := sha256.Sum256([]byte(stub.GetTxID() + "\x00" + strings.Join(parts, "\x00")))
+	return "cert-" + hex.EncodeToString(hash[:16])
+}
+
+// issueCertificate issues the platform's certificate to a trainee who just
+// passed its whole vlab catalogue and has none yet. rules are the platform's
+// scoring rules.
+func issueCertificate(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform, rules *ScoringRules) error {
+	if !completedCatalogue(trainee, platform, rules) {
+		return nil
+	}
+
+	issuedKey, err := stub.CreateCompositeKey(certificateIssuedObjectType, []string{trainee.TraineeID, platform.PlatformID})
+	if err != nil {
+		return err
+	}
+	issuedBytes, err := stub.GetState(issuedKey)
+	if err != nil {
+		return err
+	}
+	if issuedBytes != nil {
+		return nil
+	}
+
+	vlabIDs := []string{}
+	for _, platformVlab := range platform.Vlabs {
+		vlabIDs = append(vlabIDs, platformVlab.VlabID)
+	}
+
+	certificate, err := newCertificate(stub, trainee, platform, vlabIDs)
+	if err != nil {
+		return err
+	}
+	return storeCertificate(stub, certificate, issuedKey)
+}
+
+// newCertificate prepares a certificate listing the given vlabs of a
+// trainee. The caller fills in any further content and stores it.
+func newCertificate(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform, vlabIDs []string) (*Certificate, error) {
+	issuedAt, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	vlabs := []CertificateVlab{}
+	for _, vlabID := range vlabIDs {
+		vlab := trainee.VlabPointsMap2[vlabID]
+		vlabs = append(vlabs, CertificateVlab{
+			VlabID:        vlab.VlabID,
+			BoxName:       vlab.BoxName,
+			Domain:        vlab.Domain,
+			BoxDifficulty: vlab.BoxDifficulty,
+			Result:        vlab.Result,
+			AwardedPoints: vlab.AwardedPoints,
+		})
+	}
+	sort.Slice(vlabs, func(i, j int) bool {
+		return vlabs[i].VlabID < vlabs[j].VlabID
+	})
+
+	return &Certificate{
+		DocType: certificateObjectType,
+		CertificateContent: CertificateContent{
+			TraineeID:      trainee.TraineeID,
+			TraineeName:    strings.TrimSpace(trainee.FirstName + " " + trainee.LastName),
+			PlatformID:     platform.PlatformID,
+			PlatformName:   platform.PlatformName,
+			Vlabs:          vlabs,
+			TotalExpPoints: trainee.TotalExpPoints,
+			IssuedAt:       issuedAt,
+		},
+	}, nil
+}
+
+// storeCertificate assigns a certificate its ID and hash, saves it and marks
+// it issued under issuedKey
+func storeCertificate(stub shim.ChaincodeStubInterface, certificate *Certificate, issuedKey string) error {
+	parts := []string{certificate.TraineeID, certificate.PlatformID}
+	if certificate.PathID != "" {
+		parts = append(parts, certificate.PathID)
+	}
+	certificate.CertificateID = newCertificateID(stub, parts...)
+
+	var err error
+	certificate.ContentHash, err = contentHash(certificate.CertificateContent)
+	if err != nil {
+		return err
+	}
+
+	err = putCertificate(stub, certificate)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(issuedKey, []byte(certificate.CertificateID))
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(stub, CertificateIssuedEventType, CertificateIssuedEvent{
+		CertificateID: certificate.CertificateID,
+		TraineeID:     certificate.TraineeID,
+		PlatformID:    certificate.PlatformID,
+		PathID:        certificate.PathID,
+		ContentHash:   certificate.ContentHash,
+	})
+}
+
+// getCertificate returns a certificate.
+// Arguments: certificateID
+func (t *SimpleChaincode) getCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting certificateID")
+	}
+
+	certificate, err := getCertificateRecord(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certificate == nil {
+		return shim.Error("Certificate does not exist")
+	}
+
+	certificateJSON, err := json.Marshal(certificate)
+	if err != nil {
+		return shim.Error("Failed to marshal certificate to JSON")
+	}
+
+	return shim.Success(certificateJSON)
+}
+
+// listCertificates returns the certificates issued to a trainee.
+// Arguments: traineeID
+func (t *SimpleChaincode) listCertificates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(certificateIssuedObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	certificates := []Certificate{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		certificate, err := getCertificateRecord(stub, string(queryResult.Value))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if certificate != nil {
+			certificates = append(certificates, *certificate)
+		}
+	}
+
+	certificatesJSON, err := json.Marshal(certificates)
+	if err != nil {
+		return shim.Error("Failed to marshal certificates to JSON")
+	}
+
+	return shim.Success(certificatesJSON)
+}
+
+// verifyCertificate checks a certificate ID and content hash presented by its
+// holder. It needs no special identity, so employers can call it.
+// Arguments: certificateID, contentHash
+func (t *SimpleChaincode) verifyCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting certificateID and contentHash")
+	}
+
+	certificateID := args[0]
+	presentedHash := strings.ToLower(args[1])
+
+	certificate, err := getCertificateRecord(stub, certificateID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	verification := CertificateVerification{
+		CertificateID: certificateID,
+		Status:        CertificateNotFound,
+	}
+	if certificate != nil {
+		verification.HashMatches = presentedHash == certificate.ContentHash
+		verification.Revoked = certificate.Revoked
+		verification.RevokedAt = certificate.RevokedAt
+		verification.RevocationReason = certificate.RevocationReason
+
+		switch {
+		case !verification.HashMatches:
+			verification.Status = CertificateHashMismatch
+		case certificate.Revoked:
+			verification.Status = CertificateRevoked
+			verification.Certificate = certificate
+		default:
+			verification.Status = CertificateValid
+			verification.Certificate = certificate
+		}
+	}
+
+	verificationJSON, err := json.Marshal(verification)
+	if err != nil {
+		return shim.Error("Failed to marshal certificate verification to JSON")
+	}
+
+	return shim.Success(verificationJSON)
+}
+
+// revokeCertificate marks a certificate as revoked. The certificate stays on
+// the ledger so verification can report why.
+// Arguments: administratorID, certificateID, reason
+func (t *SimpleChaincode) revokeCertificate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, certificateID and reason")
+	}
+
+	administratorID := args[0]
+	certificateID := args[1]
+	reason := args[2]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+	if reason == "" {
+		return shim.Error("A revocation reason is required")
+	}
+
+	certificate, err := getCertificateRecord(stub, certificateID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if certificate == nil {
+		return shim.Error("Certificate does not exist")
+	}
+	if certificate.Revoked {
+		return shim.Error("Certificate is already revoked")
+	}
+
+	revokedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	certificate.Revoked = true
+	certificate.RevokedAt = &revokedAt
+	certificate.RevokedBy = administratorID
+	certificate.RevocationReason = reason
+
+	err = putCertificate(stub, certificate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, CertificateRevokedEventType, CertificateRevokedEvent{
+		AdministratorID: administratorID,
+		CertificateID:   certificateID,
+		TraineeID:       certificate.TraineeID,
+		Reason:          reason,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
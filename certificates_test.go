@@ -0,0 +1,54 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCertificateNeedsPassingCatalogue(t *testing.T) {
+	stub := newTestPlatform(t)
+	mustInvoke(t, stub, "addVlabToTrainee", "t1", "v2")
+
+	certificates := func() []Certificate {
+		t.Helper()
+		issued := []Certificate{}
+		err := json.Unmarshal(mustInvoke(t, stub, "listCertificates", "t1"), &issued)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issued
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "1")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v2", "1")
+	if issued := certificates(); len(issued) != 0 {
+		t.Fatalf("%d certificates after 1%% on every vlab, want none", len(issued))
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "90")
+	if issued := certificates(); len(issued) != 0 {
+		t.Fatalf("%d certificates with v2 failed, want none", len(issued))
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v2", "60")
+	issued := certificates()
+	if len(issued) != 1 || issued[0].PlatformID != "p1" {
+		t.Fatalf("certificates after passing the catalogue = %+v, want one for p1", issued)
+	}
+}
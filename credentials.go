@@ -0,0 +1,532 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// exportCredential renders certificates and badge awards in standard
+// credential formats. The documents are built from structs, so their fields
+// always come out in declaration order, and are returned as compact JSON:
+// the same credential always renders to the same bytes, and a signature made
+// off-chain over them verifies reliably. The chaincode does not sign.
+//
+// The issuer is the organization described by the issuer profile under the
+// composite key
+//
+//	issuerprofile \x00
+const issuerProfileObjectType = "issuerprofile"
+
+// Export formats of exportCredential
+const (
+	VerifiableCredentialFormat = "vc"
+	OpenBadgesFormat           = "openbadges"
+)
+
+// Contexts of the export formats
+const (
+	verifiableCredentialContext = "https://www.w3.org/2018/credentials/v1"
+	openBadgesContext           = "https://w3id.org/openbadges/v2"
+	credentialVocabulary        = "urn:fabric:vlab:vocab#"
+)
+
+// IssuerProfile describes the issuing organization. ID is an IRI, such as
+// the organization's URL or DID. Image and PublicKey are optional URLs; the
+// Open Badges export uses Image as the badge image and PublicKey as the key
+// that signs the assertion.
+type IssuerProfile struct {
+	DocType   string `json:"docType"`
+	ID        string
+	Name      string
+	URL       string
+	Email     string
+	Image     string
+	PublicKey string
+}
+
+// defaultIssuerProfile applies until an administrator sets one
+func defaultIssuerProfile(stub shim.ChaincodeStubInterface) *IssuerProfile {
+	channelID := stub.GetChannelID()
+	return &IssuerProfile{
+		DocType: issuerProfileObjectType,
+		ID:      "urn:fabric:channel:" + channelID,
+		Name:    channelID,
+	}
+}
+
+// getIssuerProfileRecord reads the issuer profile, or the default if none
+// was set
+func getIssuerProfileRecord(stub shim.ChaincodeStubInterface) (*IssuerProfile, error) {
+	profileKey, err := stub.CreateCompositeKey(issuerProfileObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	profileBytes, err := stub.GetState(profileKey)
+	if err != nil {
+		return nil, err
+	}
+	if profileBytes == nil {
+		return defaultIssuerProfile(stub), nil
+	}
+
+	profile := &IssuerProfile{}
+	err = json.Unmarshal(profileBytes, profile)
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// vcIssuer is the issuer of a verifiable credential
+type vcIssuer struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// vcContextVocabulary maps the credential's own terms into a vocabulary
+type vcContextVocabulary struct {
+	Vocab string `json:"@vocab"`
+}
+
+// vcPlatform is the platform a certificate was earned on
+type vcPlatform struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// vcVlab is one completed vlab of a certificate
+type vcVlab struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Domain     string `json:"domain"`
+	Difficulty string `json:"difficulty"`
+	Result     string `json:"result"`
+	Points     int    `json:"points"`
+}
+
+// vcCertificateSubject is the subject of an exported certificate
+type vcCertificateSubject struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name,omitempty"`
+	Platform    vcPlatform `json:"platform"`
+	Path        *vcPath    `json:"learningPath,omitempty"`
+	Vlabs       []vcVlab   `json:"vlabs"`
+	TotalPoints int        `json:"totalPoints"`
+	ContentHash string     `json:"contentHash"`
+}
+
+// vcPath is the learning path a certificate was issued for
+type vcPath struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// vcBadge is the badge of an exported badge award
+type vcBadge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// vcBadgeSubject is the subject of an exported badge award
+type vcBadgeSubject struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name,omitempty"`
+	Badge vcBadge `json:"badge"`
+}
+
+// verifiableCredential is a W3C Verifiable Credential without proof
+type verifiableCredential struct {
+	Context           []interface{} `json:"@context"`
+	ID                string        `json:"id"`
+	Type              []string      `json:"type"`
+	Issuer            vcIssuer      `json:"issuer"`
+	IssuanceDate      string        `json:"issuanceDate"`
+	CredentialSubject interface{}   `json:"credentialSubject"`
+}
+
+// obIdentity is the recipient of an Open Badges assertion
+type obIdentity struct {
+	Type     string `json:"type"`
+	Hashed   bool   `json:"hashed"`
+	Salt     string `json:"salt,omitempty"`
+	Identity string `json:"identity"`
+}
+
+// obProfile is the issuer of an Open Badges badge class
+type obProfile struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	URL       string `json:"url,omitempty"`
+	Email     string `json:"email,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+// obCriteria describes how a badge is earned
+type obCriteria struct {
+	Narrative string `json:"narrative"`
+}
+
+// obBadgeClass is the achievement of an Open Badges assertion
+type obBadgeClass struct {
+	Type        string     `json:"type"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Image       string     `json:"image,omitempty"`
+	Criteria    obCriteria `json:"criteria"`
+	Issuer      obProfile  `json:"issuer"`
+}
+
+// obVerification tells verifiers how the assertion is verified
+type obVerification struct {
+	Type    string `json:"type"`
+	Creator string `json:"creator,omitempty"`
+}
+
+// openBadgesAssertion is an Open Badges 2.0 assertion
+type openBadgesAssertion struct {
+	Context      string         `json:"@context"`
+	Type         string         `json:"type"`
+	ID           string         `json:"id"`
+	Recipient    obIdentity     `json:"recipient"`
+	Badge        obBadgeClass   `json:"badge"`
+	Verification obVerification `json:"verification"`
+	IssuedOn     string         `json:"issuedOn"`
+}
+
+// credentialTime formats a time the same way for every export
+func credentialTime(at time.Time) string {
+	return at.UTC().Format(time.RFC3339)
+}
+
+// recipientIdentity identifies the trainee of an Open Badges assertion by a
+// salted hash of the email address, or by the trainee's IRI if there is none
+func recipientIdentity(trainee *Trainee, salt string) obIdentity {
+	email := strings.ToLower(strings.TrimSpace(trainee.EmailAddress))
+	if email == "" {
+		return obIdentity{
+			Type:     "url",
+			Hashed:   false,
+			Identity: "urn:fabric:trainee:" + trainee.TraineeID,
+		}
+	}
+
+	hash := sha256.Sum256([]byte(email + salt))
+	return obIdentity{
+		Type:     "email",
+		Hashed:   true,
+		Salt:     salt,
+		Identity: "sha256$" + hex.EncodeToString(hash[:]),
+	}
+}
+
+// openBadgesIssuer renders the issuer profile
+func openBadgesIssuer(profile *IssuerProfile) obProfile {
+	return obProfile{
+		Type:      "Profile",
+		ID:        profile.ID,
+		Name:      profile.Name,
+		URL:       profile.URL,
+		Email:     profile.Email,
+		PublicKey: profile.PublicKey,
+	}
+}
+
+// openBadgesVerification declares off-chain signing by the issuer's key
+func openBadgesVerification(profile *IssuerProfile) obVerification {
+	return obVerification{
+		Type:    "signed",
+		Creator: profile.PublicKey,
+	}
+}
+
+// certificateCredential renders a certificate in the given format
+func certificateCredential(certificate *Certificate, trainee *Trainee, profile *IssuerProfile, format string) (interface{}, error) {
+	credentialID := "urn:fabric:certificate:" + certificate.CertificateID
+
+	// Certificates of a learning path describe the path instead of the
+	// platform's catalogue
+	var path *vcPath
+	badgeClassID := "urn:fabric:platform:" + certificate.PlatformID + ":certificate"
+	name := certificate.PlatformName
+	description := fmt.Sprintf("Completed all %d vlabs of %s.", len(certificate.Vlabs), certificate.PlatformName)
+	narrative := "Complete every vlab of the platform " + certificate.PlatformName + "."
+	if certificate.PathID != "" {
+		path = &vcPath{
+			ID:   "urn:fabric:learningpath:" + certificate.PlatformID + ":" + certificate.PathID,
+			Name: certificate.PathName,
+		}
+		badgeClassID = path.ID + ":certificate"
+		name = certificate.PathName
+		description = fmt.Sprintf("Completed the %d vlabs of the learning path %s on %s.", len(certificate.Vlabs), certificate.PathName, certificate.PlatformName)
+		narrative = "Complete every step of the learning path " + certificate.PathName + "."
+	}
+
+	switch format {
+	case VerifiableCredentialFormat:
+		vlabs := []vcVlab{}
+		for _, vlab := range certificate.Vlabs {
+			vlabs = append(vlabs, vcVlab{
+				ID:         "urn:fabric:vlab:" + vlab.VlabID,
+				Name:       vlab.BoxName,
+				Domain:     vlab.Domain,
+				Difficulty: vlab.BoxDifficulty,
+				Result:     vlab.Result,
+				Points:     vlab.AwardedPoints,
+			})
+		}
+		return verifiableCredential{
+			Context:      []interface{}{verifiableCredentialContext, vcContextVocabulary{Vocab: credentialVocabulary}},
+			ID:           credentialID,
+			Type:         []string{"VerifiableCredential", "CompletionCertificate"},
+			Issuer:       vcIssuer{ID: profile.ID, Name: profile.Name},
+			IssuanceDate: credentialTime(certificate.IssuedAt),
+			CredentialSubject: vcCertificateSubject{
+				ID:   "urn:fabric:trainee:" + certificate.TraineeID,
+				Name: certificate.TraineeName,
+				Platform: vcPlatform{
+					ID:   "urn:fabric:platform:" + certificate.PlatformID,
+					Name: certificate.PlatformName,
+				},
+				Path:        path,
+				Vlabs:       vlabs,
+				TotalPoints: certificate.TotalExpPoints,
+				ContentHash: certificate.ContentHash,
+			},
+		}, nil
+
+	case OpenBadgesFormat:
+		return openBadgesAssertion{
+			Context:   openBadgesContext,
+			Type:      "Assertion",
+			ID:        credentialID,
+			Recipient: recipientIdentity(trainee, certificate.CertificateID),
+			Badge: obBadgeClass{
+				Type:        "BadgeClass",
+				ID:          badgeClassID,
+				Name:        name + " completion certificate",
+				Description: description,
+				Image:       profile.Image,
+				Criteria:    obCriteria{Narrative: narrative},
+				Issuer:      openBadgesIssuer(profile),
+			},
+			Verification: openBadgesVerification(profile),
+			IssuedOn:     credentialTime(certificate.IssuedAt),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("format must be %s or %s", VerifiableCredentialFormat, OpenBadgesFormat)
+}
+
+// badgeCredential renders a badge award in the given format
+func badgeCredential(award *BadgeAward, badge *Badge, trainee *Trainee, profile *IssuerProfile, format string) (interface{}, error) {
+	credentialID := "urn:fabric:badgeaward:" + award.BadgeID + ":" + award.TraineeID
+
+	switch format {
+	case VerifiableCredentialFormat:
+		return verifiableCredential{
+			Context:      []interface{}{verifiableCredentialContext, vcContextVocabulary{Vocab: credentialVocabulary}},
+			ID:           credentialID,
+			Type:         []string{"VerifiableCredential", "BadgeCredential"},
+			Issuer:       vcIssuer{ID: profile.ID, Name: profile.Name},
+			IssuanceDate: credentialTime(award.AwardedAt),
+			CredentialSubject: vcBadgeSubject{
+				ID:   "urn:fabric:trainee:" + award.TraineeID,
+				Name: strings.TrimSpace(trainee.FirstName + " " + trainee.LastName),
+				Badge: vcBadge{
+					ID:          "urn:fabric:badge:" + badge.BadgeID,
+					Name:        badge.Name,
+					Description: badge.Description,
+				},
+			},
+		}, nil
+
+	case OpenBadgesFormat:
+		// Open Badges requires a description and criteria
+		narrative := badge.Description
+		if narrative == "" {
+			narrative = badge.Name
+		}
+		return openBadgesAssertion{
+			Context:   openBadgesContext,
+			Type:      "Assertion",
+			ID:        credentialID,
+			Recipient: recipientIdentity(trainee, credentialID),
+			Badge: obBadgeClass{
+				Type:        "BadgeClass",
+				ID:          "urn:fabric:badge:" + badge.BadgeID,
+				Name:        badge.Name,
+				Description: narrative,
+				Image:       profile.Image,
+				Criteria:    obCriteria{Narrative: narrative},
+				Issuer:      openBadgesIssuer(profile),
+			},
+			Verification: openBadgesVerification(profile),
+			IssuedOn:     credentialTime(award.AwardedAt),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("format must be %s or %s", VerifiableCredentialFormat, OpenBadgesFormat)
+}
+
+// exportCredential renders a certificate or a badge award as a W3C
+// Verifiable Credential ("vc") or an Open Badges 2.0 assertion
+// ("openbadges"). Revoked certificates are not exported.
+// Arguments: certificateID, format
+// or: badgeID, traineeID, format
+func (t *SimpleChaincode) exportCredential(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting certificateID and format, or badgeID, traineeID and format")
+	}
+
+	profile, err := getIssuerProfileRecord(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var credential interface{}
+	if len(args) == 2 {
+		certificate, err := getCertificateRecord(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if certificate == nil {
+			return shim.Error("Certificate does not exist")
+		}
+		if certificate.Revoked {
+			return shim.Error("Certificate is revoked")
+		}
+
+		trainee, err := getTraineeRecord(stub, certificate.TraineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		credential, err = certificateCredential(certificate, trainee, profile, args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		badgeID := args[0]
+		traineeID := args[1]
+
+		badge, err := getBadgeRecord(stub, badgeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if badge == nil {
+			return shim.Error("Badge does not exist")
+		}
+
+		awardKey, err := stub.CreateCompositeKey(badgeAwardObjectType, []string{traineeID, badgeID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		awardBytes, err := stub.GetState(awardKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if awardBytes == nil {
+			return shim.Error("Trainee does not hold that badge")
+		}
+		award := &BadgeAward{}
+		err = json.Unmarshal(awardBytes, award)
+		if err != nil {
+			return shim.Error("Failed to unmarshal badge award JSON")
+		}
+
+		trainee, err := getTraineeRecord(stub, traineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		credential, err = badgeCredential(award, badge, trainee, profile, args[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return shim.Error("Failed to marshal credential to JSON")
+	}
+
+	return shim.Success(credentialJSON)
+}
+
+// setIssuerProfile stores the issuing organization named in exported
+// credentials.
+// Arguments: administratorID, profile JSON
+// e.g. {"ID":"https://academy.example.com","Name":"Example Academy","URL":"https://academy.example.com"}
+func (t *SimpleChaincode) setIssuerProfile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID and profile")
+	}
+
+	administratorID := args[0]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	profile := &IssuerProfile{}
+	err := json.Unmarshal([]byte(args[1]), profile)
+	if err != nil {
+		return shim.Error("Failed to unmarshal issuer profile JSON")
+	}
+	if profile.ID == "" || profile.Name == "" {
+		return shim.Error("The issuer profile needs an ID and a Name")
+	}
+	profile.DocType = issuerProfileObjectType
+
+	profileJSON, err := json.Marshal(profile)
+	if err != nil {
+		return shim.Error("Failed to marshal issuer profile to JSON")
+	}
+
+	profileKey, err := stub.CreateCompositeKey(issuerProfileObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(profileKey, profileJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, IssuerProfileSetEventType, IssuerProfileSetEvent{
+		AdministratorID: administratorID,
+		Profile:         *profile,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
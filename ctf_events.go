@@ -0,0 +1,702 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Competition events live under two composite keys
+//
+//	event \x00 platformID \x00 eventID \x00
+//	eventsolve \x00 platformID \x00 eventID \x00 vlabID \x00 traineeID \x00
+//
+// A passing result recorded by ScoreTheVlab between the event's StartTime
+// and EndTime, by the transaction timestamp, is a solve of the event. Results
+// recorded outside the window do not count for the event. A later failing or
+// cleared result inside the window withdraws the solve.
+//
+// For the last FreezeMinutes of an event the scoreboard shows the standings
+// as they were when the freeze began, while solves keep being recorded. The
+// full scoreboard is revealed once the event has ended.
+const (
+	eventObjectType      = "event"
+	eventSolveObjectType = "eventsolve"
+)
+
+// Statuses of an event's scoreboard
+const (
+	EventUpcoming = "upcoming"
+	EventRunning  = "running"
+	EventFrozen   = "frozen"
+	EventClosed   = "closed"
+)
+
+// Event is a time-boxed competition over some of a platform's vlabs
+type Event struct {
+	DocType       string `json:"docType"`
+	EventID       string
+	PlatformID    string
+	Name          string
+	VlabIDs       []string
+	StartTime     time.Time
+	EndTime       time.Time
+	FreezeMinutes int
+	Scoring       *DynamicScoring `json:"Scoring,omitempty"`
+	CreatedBy     string
+}
+
+// EventSolve is a trainee's solve of one vlab of an event. SolveNumber orders
+// the solves of a vlab. FrozenPoints and FrozenSolvedAt keep the points and
+// solve time shown on the frozen scoreboard when the solve changed during the
+// freeze.
+type EventSolve struct {
+	DocType        string `json:"docType"`
+	EventID        string
+	VlabID         string
+	TraineeID      string
+	SolveNumber    int
+	Result         string
+	Points         int
+	SolvedAt       time.Time
+	UpdatedAt      time.Time
+	Withdrawn      bool
+	FrozenPoints   *int       `json:"FrozenPoints,omitempty"`
+	FrozenSolvedAt *time.Time `json:"FrozenSolvedAt,omitempty"`
+}
+
+// EventStanding is one row of an event scoreboard
+type EventStanding struct {
+	Rank        int
+	TraineeID   string
+	Nickname    string
+	Points      int
+	Solves      int
+	LastSolveAt time.Time
+}
+
+// EventScoreboard is returned by getEventScoreboard
+type EventScoreboard struct {
+	EventID   string
+	Name      string
+	Status    string
+	StartTime time.Time
+	EndTime   time.Time
+	FrozenAt  *time.Time `json:"FrozenAt,omitempty"`
+	Standings []EventStanding
+}
+
+// freezeTime returns when the event's scoreboard freezes
+func (event *Event) freezeTime() time.Time {
+	return event.EndTime.Add(-time.Duration(event.FreezeMinutes) * time.Minute)
+}
+
+// status returns the state of the event at a time
+func (event *Event) status(at time.Time) string {
+	switch {
+	case at.Before(event.StartTime):
+		return EventUpcoming
+	case !at.Before(event.EndTime):
+		return EventClosed
+	case event.FreezeMinutes > 0 && !at.Before(event.freezeTime()):
+		return EventFrozen
+	}
+	return EventRunning
+}
+
+// includes reports whether a vlab is part of the event
+func (event *Event) includes(vlabID string) bool {
+	for _, id := range event.VlabIDs {
+		if id == vlabID {
+			return true
+		}
+	}
+	return false
+}
+
+// getEventRecord reads an event, or nil if it does not exist
+func getEventRecord(stub shim.ChaincodeStubInterface, platformID string, eventID string) (*Event, error) {
+	eventKey, err := stub.CreateCompositeKey(eventObjectType, []string{platformID, eventID})
+	if err != nil {
+		return nil, err
+	}
+
+	eventBytes, err := stub.GetState(eventKey)
+	if err != nil {
+		return nil, err
+	}
+	if eventBytes == nil {
+		return nil, nil
+	}
+
+	event := &Event{}
+	err = json.Unmarshal(eventBytes, event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// putEventSolve saves a solve
+func putEventSolve(stub shim.ChaincodeStubInterface, platformID string, solve *EventSolve) error {
+	solveJSON, err := json.Marshal(solve)
+	if err != nil {
+		return err
+	}
+
+	solveKey, err := stub.CreateCompositeKey(eventSolveObjectType, []string{platformID, solve.EventID, solve.VlabID, solve.TraineeID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(solveKey, solveJSON)
+}
+
+// update sets the result and points of a solve, keeping what the frozen
+// scoreboard showed for a solve that stood before the freeze
+func (solve *EventSolve) update(event *Event, at time.Time, result string, points int, withdrawn bool) {
+	if event.status(at) == EventFrozen && solve.FrozenPoints == nil && !solve.Withdrawn && solve.SolvedAt.Before(event.freezeTime()) {
+		frozenPoints := solve.Points
+		frozenSolvedAt := solve.SolvedAt
+		solve.FrozenPoints = &frozenPoints
+		solve.FrozenSolvedAt = &frozenSolvedAt
+	}
+
+	solve.Result = result
+	solve.Points = points
+	solve.Withdrawn = withdrawn
+	if withdrawn {
+		solve.Points = 0
+	}
+	solve.UpdatedAt = at
+}
+
+// frozen returns a solve as the frozen scoreboard shows it, and false if the
+// scoreboard does not show it. A solve that stood before the freeze is shown
+// as it stood, even if it was withdrawn or solved again since.
+func (solve EventSolve) frozen(freezeTime time.Time) (EventSolve, bool) {
+	if solve.FrozenPoints == nil {
+		return solve, solve.SolvedAt.Before(freezeTime)
+	}
+
+	solve.Points = *solve.FrozenPoints
+	if solve.FrozenSolvedAt != nil {
+		solve.SolvedAt = *solve.FrozenSolvedAt
+	}
+	solve.Withdrawn = false
+	solve.Result = ""
+	solve.UpdatedAt = solve.SolvedAt
+	solve.FrozenPoints = nil
+	solve.FrozenSolvedAt = nil
+	return solve, true
+}
+
+// recordEventSolves updates the solves of the running events of the
+// trainee's platform that include the scored vlab. In an event with dynamic
+// scoring it also sets the points of vlab and re-awards the other solvers.
+func recordEventSolves(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform, vlab *Vlab, rules *ScoringRules) error {
+	at, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(eventObjectType, []string{trainee.ActivePlatform})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		event := Event{}
+		err = json.Unmarshal(queryResult.Value, &event)
+		if err != nil {
+			return err
+		}
+		status := event.status(at)
+		if (status != EventRunning && status != EventFrozen) || !event.includes(vlab.VlabID) {
+			continue
+		}
+
+		solves, err := eventVlabSolves(stub, event.PlatformID, event.EventID, vlab.VlabID)
+		if err != nil {
+			return err
+		}
+		current := -1
+		lastSolveNumber := 0
+		for i := range solves {
+			if solves[i].TraineeID == trainee.TraineeID {
+				current = i
+			}
+			if solves[i].SolveNumber > lastSolveNumber {
+				lastSolveNumber = solves[i].SolveNumber
+			}
+		}
+
+		solved := rules.passes(*vlab)
+		if current < 0 && !solved {
+			continue
+		}
+		if current < 0 {
+			solves = append(solves, EventSolve{
+				DocType:   eventSolveObjectType,
+				EventID:   event.EventID,
+				VlabID:    vlab.VlabID,
+				TraineeID: trainee.TraineeID,
+				Withdrawn: true,
+			})
+			current = len(solves) - 1
+		}
+
+		// A new solve, or one withdrawn and solved again, goes to the back
+		// of the solve order
+		solve := &solves[current]
+		if solved && solve.Withdrawn {
+			solve.SolveNumber = lastSolveNumber + 1
+			solve.SolvedAt = at
+		}
+		solve.update(&event, at, vlab.Result, vlab.AwardedPoints, !solved)
+
+		if event.Scoring == nil {
+			err = putEventSolve(stub, event.PlatformID, solve)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		sortSolves(solves)
+		err = rescoreEventVlab(stub, &event, solves, trainee, platform, vlab, rules, at)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createEvent schedules a competition over vlabs of a platform's catalogue.
+// A vlab of an event with dynamic scoring cannot be part of another event
+// at the same time.
+// Arguments: administratorID, platformID, eventID, name, vlab IDs as a JSON array, startTime, endTime, optional freezeMinutes, optional dynamic scoring JSON
+// e.g. {"Curve":"parabolic","MinimumFraction":0.2,"Decay":20,"FirstBloodBonuses":[50,30,10]}
+func (t *SimpleChaincode) createEvent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 7 || len(args) > 9 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID, eventID, name, vlabIDs, startTime, endTime, optional freezeMinutes and optional scoring")
+	}
+
+	administratorID := args[0]
+	platformID := args[1]
+	eventID := args[2]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+	if eventID == "" {
+		return shim.Error("eventID must not be empty")
+	}
+
+	startTime, err := time.Parse(time.RFC3339, args[5])
+	if err != nil {
+		return shim.Error("startTime must be an RFC3339 timestamp")
+	}
+	endTime, err := time.Parse(time.RFC3339, args[6])
+	if err != nil {
+		return shim.Error("endTime must be an RFC3339 timestamp")
+	}
+	if !endTime.After(startTime) {
+		return shim.Error("endTime must be after startTime")
+	}
+
+	freezeMinutes := 0
+	if len(args) > 7 && args[7] != "" {
+		freezeMinutes, err = strconv.Atoi(args[7])
+		if err != nil || freezeMinutes < 0 {
+			return shim.Error("freezeMinutes must be a non-negative integer")
+		}
+		if time.Duration(freezeMinutes)*time.Minute > endTime.Sub(startTime) {
+			return shim.Error("The freeze must not be longer than the event")
+		}
+	}
+
+	var scoring *DynamicScoring
+	if len(args) > 8 && args[8] != "" {
+		scoring = &DynamicScoring{}
+		err = json.Unmarshal([]byte(args[8]), scoring)
+		if err != nil {
+			return shim.Error("Failed to unmarshal dynamic scoring JSON")
+		}
+		err = scoring.validate()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Get the platform from the ledger
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+	var platform Platform
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check if the event already exists
+	existing, err := getEventRecord(stub, platformID, eventID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Event already exists")
+	}
+
+	vlabIDs := []string{}
+	err = json.Unmarshal([]byte(args[4]), &vlabIDs)
+	if err != nil {
+		return shim.Error("Failed to unmarshal vlab IDs JSON array")
+	}
+	if len(vlabIDs) == 0 {
+		return shim.Error("An event needs at least one vlab")
+	}
+
+	catalogue := map[string]bool{}
+	for _, vlab := range platform.Vlabs {
+		catalogue[vlab.VlabID] = true
+	}
+	seen := map[string]bool{}
+	for _, vlabID := range vlabIDs {
+		if !catalogue[vlabID] {
+			return shim.Error(fmt.Sprintf("Vlab %s is not in the catalogue of platform %s", vlabID, platformID))
+		}
+		if seen[vlabID] {
+			return shim.Error(fmt.Sprintf("Vlab %s is listed twice", vlabID))
+		}
+		seen[vlabID] = true
+	}
+
+	// Dynamic points of a vlab must come from a single event at a time
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(eventObjectType, []string{platformID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		other := Event{}
+		err = json.Unmarshal(queryResult.Value, &other)
+		if err != nil {
+			return shim.Error("Failed to unmarshal event JSON")
+		}
+		if scoring == nil && other.Scoring == nil {
+			continue
+		}
+		if !other.StartTime.Before(endTime) || !startTime.Before(other.EndTime) {
+			continue
+		}
+		for _, vlabID := range vlabIDs {
+			if other.includes(vlabID) {
+				return shim.Error(fmt.Sprintf("Vlab %s is part of event %s at the same time, and one of the events has dynamic scoring", vlabID, other.EventID))
+			}
+		}
+	}
+
+	event := Event{
+		DocType:       eventObjectType,
+		EventID:       eventID,
+		PlatformID:    platformID,
+		Name:          args[3],
+		VlabIDs:       vlabIDs,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		FreezeMinutes: freezeMinutes,
+		Scoring:       scoring,
+		CreatedBy:     administratorID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return shim.Error("Failed to marshal event to JSON")
+	}
+
+	eventKey, err := stub.CreateCompositeKey(eventObjectType, []string{platformID, eventID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(eventKey, eventJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, EventCreatedEventType, EventCreatedEvent{
+		AdministratorID: administratorID,
+		Event:           event,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getEvent returns an event.
+// Arguments: platformID, eventID
+func (t *SimpleChaincode) getEvent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and eventID")
+	}
+
+	event, err := getEventRecord(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if event == nil {
+		return shim.Error("Event does not exist")
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return shim.Error("Failed to marshal event to JSON")
+	}
+
+	return shim.Success(eventJSON)
+}
+
+// listEvents returns the events of a platform.
+// Arguments: platformID
+func (t *SimpleChaincode) listEvents(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(eventObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	events := []Event{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		event := Event{}
+		err = json.Unmarshal(queryResult.Value, &event)
+		if err != nil {
+			return shim.Error("Failed to unmarshal event JSON")
+		}
+		events = append(events, event)
+	}
+
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return shim.Error("Failed to marshal events to JSON")
+	}
+
+	return shim.Success(eventsJSON)
+}
+
+// getEventScoreboard ranks the trainees of an event by their points, ties
+// broken by the earlier last solve. During the freeze it shows the standings
+// from when the freeze began.
+// Arguments: platformID, eventID
+func (t *SimpleChaincode) getEventScoreboard(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and eventID")
+	}
+
+	platformID := args[0]
+	eventID := args[1]
+
+	event, err := getEventRecord(stub, platformID, eventID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if event == nil {
+		return shim.Error("Event does not exist")
+	}
+
+	at, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	scoreboard := EventScoreboard{
+		EventID:   event.EventID,
+		Name:      event.Name,
+		Status:    event.status(at),
+		StartTime: event.StartTime,
+		EndTime:   event.EndTime,
+		Standings: []EventStanding{},
+	}
+	frozenAt := event.freezeTime()
+	if scoreboard.Status == EventFrozen {
+		scoreboard.FrozenAt = &frozenAt
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(eventSolveObjectType, []string{platformID, eventID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	standings := map[string]*EventStanding{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		solve := EventSolve{}
+		err = json.Unmarshal(queryResult.Value, &solve)
+		if err != nil {
+			return shim.Error("Failed to unmarshal event solve JSON")
+		}
+
+		if scoreboard.Status == EventFrozen {
+			shown := false
+			solve, shown = solve.frozen(frozenAt)
+			if !shown {
+				continue
+			}
+		}
+		if solve.Withdrawn {
+			continue
+		}
+
+		standing, exists := standings[solve.TraineeID]
+		if !exists {
+			standing = &EventStanding{TraineeID: solve.TraineeID}
+			standings[solve.TraineeID] = standing
+		}
+		standing.Points += solve.Points
+		standing.Solves++
+		if solve.SolvedAt.After(standing.LastSolveAt) {
+			standing.LastSolveAt = solve.SolvedAt
+		}
+	}
+
+	// Nicknames come from the platform's copies of its trainees
+	nicknames := map[string]string{}
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes != nil {
+		platform := Platform{}
+		err = json.Unmarshal(platformBytes, &platform)
+		if err != nil {
+			return shim.Error("Failed to unmarshal platform JSON")
+		}
+		for _, trainee := range platform.Trainees {
+			nicknames[trainee.TraineeID] = trainee.Nickname
+		}
+	}
+
+	for _, standing := range standings {
+		standing.Nickname = nicknames[standing.TraineeID]
+		scoreboard.Standings = append(scoreboard.Standings, *standing)
+	}
+	sort.Slice(scoreboard.Standings, func(i, j int) bool {
+		a, b := scoreboard.Standings[i], scoreboard.Standings[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if !a.LastSolveAt.Equal(b.LastSolveAt) {
+			return a.LastSolveAt.Before(b.LastSolveAt)
+		}
+		return a.TraineeID < b.TraineeID
+	})
+	for i := range scoreboard.Standings {
+		scoreboard.Standings[i].Rank = i + 1
+	}
+
+	scoreboardJSON, err := json.Marshal(scoreboard)
+	if err != nil {
+		return shim.Error("Failed to marshal event scoreboard to JSON")
+	}
+
+	return shim.Success(scoreboardJSON)
+}
+
+// getEventSolves returns the solves of a vlab in an event in solve order.
+// During the freeze, solves made since the freeze began are left out and
+// solves changed since show their points and no result.
+// Arguments: platformID, eventID, vlabID
+func (t *SimpleChaincode) getEventSolves(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID, eventID and vlabID")
+	}
+
+	event, err := getEventRecord(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if event == nil {
+		return shim.Error("Event does not exist")
+	}
+
+	at, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	solves, err := eventVlabSolves(stub, event.PlatformID, event.EventID, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if event.status(at) == EventFrozen {
+		visible := []EventSolve{}
+		for _, solve := range solves {
+			solve, shown := solve.frozen(event.freezeTime())
+			if shown {
+				visible = append(visible, solve)
+			}
+		}
+		solves = visible
+	}
+
+	solvesJSON, err := json.Marshal(solves)
+	if err != nil {
+		return shim.Error("Failed to marshal event solves to JSON")
+	}
+
+	return shim.Success(solvesJSON)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// eventPoints returns the points of each trainee on an event scoreboard
+func eventPoints(t *testing.T, stub *testStub, eventID string) (string, map[string]int) {
+	t.Helper()
+	scoreboard := EventScoreboard{}
+	err := json.Unmarshal(mustInvoke(t, stub, "getEventScoreboard", "p1", eventID), &scoreboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := map[string]int{}
+	for _, standing := range scoreboard.Standings {
+		points[standing.TraineeID] = standing.Points
+	}
+	return scoreboard.Status, points
+}
+
+func TestFrozenScoreboardKeepsPreFreezeSolves(t *testing.T) {
+	stub := newTestPlatform(t)
+	start := stub.now
+	mustInvoke(t, stub, "createEvent", "admin1", "p1", "e1", "Event 1", `["v1"]`,
+		start.Format(time.RFC3339), start.Add(2*time.Hour).Format(time.RFC3339), "60")
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "80")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t2", "v1", "60")
+
+	// Into the freeze: t1 is withdrawn and solves again, t2 is withdrawn
+	// and t3 solves for the first time
+	stub.now = start.Add(time.Hour)
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "0")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "90")
+	mustInvoke(t, stub, "removeVlabScore", "Trainer1", "t2", "v1")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t3", "v1", "70")
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		status string
+		points map[string]int
+	}{
+		{"frozen", start.Add(90 * time.Minute), EventFrozen, map[string]int{"t1": 80, "t2": 60}},
+		{"closed", start.Add(3 * time.Hour), EventClosed, map[string]int{"t1": 90, "t3": 70}},
+	}
+	for _, test := range tests {
+		stub.now = test.at
+		status, points := eventPoints(t, stub, "e1")
+		if status != test.status {
+			t.Errorf("%s: status = %s, want %s", test.name, status, test.status)
+		}
+		if len(points) != len(test.points) {
+			t.Errorf("%s: standings = %v, want %v", test.name, points, test.points)
+		}
+		for traineeID, want := range test.points {
+			if points[traineeID] != want {
+				t.Errorf("%s: %s has %d points, want %d", test.name, traineeID, points[traineeID], want)
+			}
+		}
+	}
+}
+
+func TestEventSolvesNeedPassingResults(t *testing.T) {
+	stub := newTestPlatform(t)
+	start := stub.now
+	mustInvoke(t, stub, "createEvent", "admin1", "p1", "e1", "Event 1", `["v1"]`,
+		start.Format(time.RFC3339), start.Add(2*time.Hour).Format(time.RFC3339), "0",
+		`{"Curve":"linear","MinimumFraction":0.5,"Decay":10,"FirstBloodBonuses":[50]}`)
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "1")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t2", "v1", "60")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t3", "v1", "75")
+	// A failing result withdraws an earlier solve
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t3", "v1", "20")
+
+	solves := []EventSolve{}
+	err := json.Unmarshal(mustInvoke(t, stub, "getEventSolves", "p1", "e1", "v1"), &solves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standing := map[string]EventSolve{}
+	for _, solve := range solves {
+		if !solve.Withdrawn {
+			standing[solve.TraineeID] = solve
+		}
+	}
+	if len(standing) != 1 || standing["t2"].SolveNumber != 1 {
+		t.Fatalf("standing solves = %+v, want t2 as the first solve", solves)
+	}
+
+	// 60% of the full value of v1 and the first blood bonus
+	_, points := eventPoints(t, stub, "e1")
+	if len(points) != 1 || points["t2"] != 110 {
+		t.Errorf("event points = %v, want 110 for t2 only", points)
+	}
+}
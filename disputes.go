@@ -0,0 +1,441 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Disputes live under two composite keys
+//
+//	dispute \x00 disputeID \x00
+//	disputeindex \x00 traineeID \x00 vlabID \x00 disputeID \x00    the dispute ID
+//
+// A dispute is never deleted: its thread of messages and its outcome stay on
+// the ledger. A trainee has at most one open dispute per vlab.
+const (
+	disputeObjectType      = "dispute"
+	disputeIndexObjectType = "disputeindex"
+)
+
+// Dispute statuses and resolution outcomes
+const (
+	DisputeOpen     = "open"
+	DisputeUpheld   = "upheld"
+	DisputeRejected = "rejected"
+)
+
+// DisputeMessage is one message of a dispute's thread
+type DisputeMessage struct {
+	AuthorID string
+	Message  string
+	At       time.Time
+}
+
+// Dispute is a trainee's appeal against a recorded result. An upheld
+// dispute replaces the result with CorrectedResult.
+type Dispute struct {
+	DocType         string `json:"docType"`
+	DisputeID       string
+	TraineeID       string
+	VlabID          string
+	PlatformID      string
+	DisputedResult  string
+	Status          string
+	Thread          []DisputeMessage
+	OpenedAt        time.Time
+	CorrectedResult string     `json:"CorrectedResult,omitempty"`
+	ResolvedBy      string     `json:"ResolvedBy,omitempty"`
+	ResolvedAt      *time.Time `json:"ResolvedAt,omitempty"`
+}
+
+// getDisputeRecord reads a dispute, or nil if it does not exist
+func getDisputeRecord(stub shim.ChaincodeStubInterface, disputeID string) (*Dispute, error) {
+	disputeKey, err := stub.CreateCompositeKey(disputeObjectType, []string{disputeID})
+	if err != nil {
+		return nil, err
+	}
+
+	disputeBytes, err := stub.GetState(disputeKey)
+	if err != nil {
+		return nil, err
+	}
+	if disputeBytes == nil {
+		return nil, nil
+	}
+
+	dispute := &Dispute{}
+	err = json.Unmarshal(disputeBytes, dispute)
+	if err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// putDispute saves a dispute
+func putDispute(stub shim.ChaincodeStubInterface, dispute *Dispute) error {
+	disputeJSON, err := json.Marshal(dispute)
+	if err != nil {
+		return err
+	}
+
+	disputeKey, err := stub.CreateCompositeKey(disputeObjectType, []string{dispute.DisputeID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(disputeKey, disputeJSON)
+}
+
+// openDisputeOf returns the open dispute of a trainee about a vlab, or nil
+func openDisputeOf(stub shim.ChaincodeStubInterface, traineeID string, vlabID string) (*Dispute, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(disputeIndexObjectType, []string{traineeID, vlabID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		dispute, err := getDisputeRecord(stub, string(queryResult.Value))
+		if err != nil {
+			return nil, err
+		}
+		if dispute != nil && dispute.Status == DisputeOpen {
+			return dispute, nil
+		}
+	}
+	return nil, nil
+}
+
+// openDispute lets a trainee appeal the recorded result of a vlab. The
+// reason starts the dispute's thread. Returns the dispute ID.
+// Arguments: traineeID, vlabID, reason
+func (t *SimpleChaincode) openDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID, vlabID and reason")
+	}
+
+	traineeID := args[0]
+	vlabID := args[1]
+	reason := args[2]
+
+	if reason == "" {
+		return shim.Error("A reason is required")
+	}
+
+	trainee, err := getTraineeRecord(stub, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	vlab, exists := trainee.VlabPointsMap2[vlabID]
+	if !exists {
+		return shim.Error("Trainee does not have that vlabID")
+	}
+	if vlab.Result == "" {
+		return shim.Error("Vlab has not been scored")
+	}
+
+	existing, err := openDisputeOf(stub, traineeID, vlabID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Dispute " + existing.DisputeID + " about that vlab is still open")
+	}
+
+	openedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	dispute := Dispute{
+		DocType:        disputeObjectType,
+		DisputeID:      "dispute-" + stub.GetTxID(),
+		TraineeID:      traineeID,
+		VlabID:         vlabID,
+		PlatformID:     trainee.ActivePlatform,
+		DisputedResult: vlab.Result,
+		Status:         DisputeOpen,
+		Thread: []DisputeMessage{{
+			AuthorID: traineeID,
+			Message:  reason,
+			At:       openedAt,
+		}},
+		OpenedAt: openedAt,
+	}
+
+	err = putDispute(stub, &dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	indexKey, err := stub.CreateCompositeKey(disputeIndexObjectType, []string{traineeID, vlabID, dispute.DisputeID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(indexKey, []byte(dispute.DisputeID))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, DisputeOpenedEventType, DisputeOpenedEvent{
+		DisputeID:      dispute.DisputeID,
+		TraineeID:      traineeID,
+		VlabID:         vlabID,
+		PlatformID:     dispute.PlatformID,
+		DisputedResult: dispute.DisputedResult,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(dispute.DisputeID))
+}
+
+// respondToDispute adds a message to the thread of an open dispute. Trainers,
+// administrators and the disputing trainee can respond.
+// Arguments: authorID, disputeID, message
+func (t *SimpleChaincode) respondToDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting authorID, disputeID and message")
+	}
+
+	authorID := args[0]
+	disputeID := args[1]
+	message := args[2]
+
+	if message == "" {
+		return shim.Error("message must not be empty")
+	}
+
+	dispute, err := getDisputeRecord(stub, disputeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dispute == nil {
+		return shim.Error("Dispute does not exist")
+	}
+
+	// Check if authorID starts with "Trainer" or "admin", or is the trainee
+	if !strings.HasPrefix(authorID, "Trainer") && !strings.HasPrefix(authorID, "admin") && authorID != dispute.TraineeID {
+		return shim.Error("Not authorized for that transaction.")
+	}
+	if dispute.Status != DisputeOpen {
+		return shim.Error("Dispute is already resolved")
+	}
+
+	at, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dispute.Thread = append(dispute.Thread, DisputeMessage{
+		AuthorID: authorID,
+		Message:  message,
+		At:       at,
+	})
+
+	err = putDispute(stub, dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, DisputeRespondedEventType, DisputeRespondedEvent{
+		DisputeID: disputeID,
+		AuthorID:  authorID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// resolveDispute closes a dispute. An upheld dispute replaces the result
+// with the corrected one, graded as of the disputed grading so no extra late
+// penalty applies, and recomputes the trainee's experience points.
+// Arguments: trainerID or administratorID, disputeID, outcome (upheld or rejected), correctedResult if upheld (a result or criterion scores), optional note
+func (t *SimpleChaincode) resolveDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting trainerID or administratorID, disputeID, outcome, correctedResult and optional note")
+	}
+
+	resolverID := args[0]
+	disputeID := args[1]
+	outcome := args[2]
+	correctedResult := ""
+	if len(args) > 3 {
+		correctedResult = args[3]
+	}
+	note := ""
+	if len(args) > 4 {
+		note = args[4]
+	}
+
+	// Check if resolverID starts with "Trainer" or "admin"
+	if !strings.HasPrefix(resolverID, "Trainer") && !strings.HasPrefix(resolverID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	switch outcome {
+	case DisputeUpheld:
+		if correctedResult == "" {
+			return shim.Error("An upheld dispute needs the corrected result")
+		}
+	case DisputeRejected:
+		if correctedResult != "" {
+			return shim.Error("A rejected dispute takes no corrected result")
+		}
+	default:
+		return shim.Error(fmt.Sprintf("outcome must be %s or %s", DisputeUpheld, DisputeRejected))
+	}
+
+	dispute, err := getDisputeRecord(stub, disputeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dispute == nil {
+		return shim.Error("Dispute does not exist")
+	}
+	if dispute.Status != DisputeOpen {
+		return shim.Error("Dispute is already resolved")
+	}
+
+	if outcome == DisputeUpheld {
+		trainee, err := getTraineeRecord(stub, dispute.TraineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if trainee.ActivePlatform != dispute.PlatformID {
+			return shim.Error("Trainee has left the platform of the disputed result")
+		}
+		vlab, exists := trainee.VlabPointsMap2[dispute.VlabID]
+		if !exists {
+			return shim.Error("Trainee does not have that vlabID")
+		}
+
+		response := t.setVlabResult(stub, resolverID, dispute.TraineeID, dispute.VlabID, correctedResult, vlab.TimeSpent, vlab.GradedAt)
+		if response.Status != shim.OK {
+			return response
+		}
+	}
+
+	at, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if note != "" {
+		dispute.Thread = append(dispute.Thread, DisputeMessage{
+			AuthorID: resolverID,
+			Message:  note,
+			At:       at,
+		})
+	}
+	dispute.Status = outcome
+	dispute.CorrectedResult = correctedResult
+	dispute.ResolvedBy = resolverID
+	dispute.ResolvedAt = &at
+
+	err = putDispute(stub, dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, DisputeResolvedEventType, DisputeResolvedEvent{
+		DisputeID:       disputeID,
+		ResolverID:      resolverID,
+		TraineeID:       dispute.TraineeID,
+		VlabID:          dispute.VlabID,
+		Outcome:         outcome,
+		CorrectedResult: correctedResult,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getDispute returns a dispute with its thread.
+// Arguments: disputeID
+func (t *SimpleChaincode) getDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting disputeID")
+	}
+
+	dispute, err := getDisputeRecord(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if dispute == nil {
+		return shim.Error("Dispute does not exist")
+	}
+
+	disputeJSON, err := json.Marshal(dispute)
+	if err != nil {
+		return shim.Error("Failed to marshal dispute to JSON")
+	}
+
+	return shim.Success(disputeJSON)
+}
+
+// listDisputes returns the disputes a trainee opened, optionally only those
+// about one vlab.
+// Arguments: traineeID, optional vlabID
+func (t *SimpleChaincode) listDisputes(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID and optional vlabID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(disputeIndexObjectType, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	disputes := []Dispute{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		dispute, err := getDisputeRecord(stub, string(queryResult.Value))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if dispute != nil {
+			disputes = append(disputes, *dispute)
+		}
+	}
+
+	disputesJSON, err := json.Marshal(disputes)
+	if err != nil {
+		return shim.Error("Failed to marshal disputes to JSON")
+	}
+
+	return shim.Success(disputesJSON)
+}
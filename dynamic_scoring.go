@@ -0,0 +1,300 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// An event with dynamic scoring lowers the value of a vlab as more trainees
+// solve it. With n standing solves of a vlab worth ExpPoints:
+//
+//	linear:     value = ExpPoints - (ExpPoints - minimum) * (n-1) / Decay
+//	parabolic:  value = ExpPoints - (ExpPoints - minimum) * ((n-1) / Decay)^2
+//
+// never below minimum = ExpPoints * MinimumFraction. Every solver earns the
+// current value, passed through the platform's scoring rules in place of
+// ExpPoints, so earlier solvers lose points when a new solve comes in. The
+// k-th solver also earns FirstBloodBonuses[k-1] on top. Solves are ordered
+// by SolveNumber; a withdrawn solve gives up its place.
+
+// Decay curves of dynamic scoring
+const (
+	LinearDecay    = "linear"
+	ParabolicDecay = "parabolic"
+)
+
+// DynamicScoring configures the dynamic scoring of an event
+type DynamicScoring struct {
+	Curve             string
+	MinimumFraction   float64
+	Decay             int
+	FirstBloodBonuses []int `json:"FirstBloodBonuses,omitempty"`
+}
+
+// validate checks dynamic scoring submitted by an administrator
+func (scoring *DynamicScoring) validate() error {
+	if scoring.Curve != LinearDecay && scoring.Curve != ParabolicDecay {
+		return fmt.Errorf("Curve must be %s or %s", LinearDecay, ParabolicDecay)
+	}
+	if !(scoring.MinimumFraction >= 0 && scoring.MinimumFraction <= 1) {
+		return fmt.Errorf("MinimumFraction must be between 0 and 1")
+	}
+	if scoring.Decay <= 0 {
+		return fmt.Errorf("Decay must be a positive integer")
+	}
+	for _, bonus := range scoring.FirstBloodBonuses {
+		if bonus < 0 {
+			return fmt.Errorf("FirstBloodBonuses must not be negative")
+		}
+	}
+	return nil
+}
+
+// value returns what a vlab worth expPoints is worth after solves solves
+func (scoring *DynamicScoring) value(expPoints int, solves int) int {
+	minimum := float64(expPoints) * scoring.MinimumFraction
+	progress := math.Min(1, float64(solves-1)/float64(scoring.Decay))
+	if progress < 0 {
+		progress = 0
+	}
+	if scoring.Curve == ParabolicDecay {
+		progress = progress * progress
+	}
+	return int(math.Round(float64(expPoints) - (float64(expPoints)-minimum)*progress))
+}
+
+// bonus returns the first blood bonus of the solver at rank
+func (scoring *DynamicScoring) bonus(rank int) int {
+	if rank < 1 || rank > len(scoring.FirstBloodBonuses) {
+		return 0
+	}
+	return scoring.FirstBloodBonuses[rank-1]
+}
+
+// dynamicAward returns the points a result earns as the rank-th of solves
+// standing solves
+func dynamicAward(rules *ScoringRules, scoring *DynamicScoring, vlab Vlab, rank int, solves int) (int, error) {
+	expPoints, err := strconv.Atoi(vlab.ExpPoints)
+	if err != nil {
+		return 0, fmt.Errorf("ExpPoints of vlab %s must be an integer", vlab.VlabID)
+	}
+
+	vlab.ExpPoints = strconv.Itoa(scoring.value(expPoints, solves))
+	points, err := rules.award(vlab)
+	if err != nil {
+		return 0, err
+	}
+	return points + scoring.bonus(rank), nil
+}
+
+// eventVlabSolves returns every solve of a vlab in an event, withdrawn ones
+// included, in solve order
+func eventVlabSolves(stub shim.ChaincodeStubInterface, platformID string, eventID string, vlabID string) ([]EventSolve, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(eventSolveObjectType, []string{platformID, eventID, vlabID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	solves := []EventSolve{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		solve := EventSolve{}
+		err = json.Unmarshal(queryResult.Value, &solve)
+		if err != nil {
+			return nil, err
+		}
+		solves = append(solves, solve)
+	}
+
+	sortSolves(solves)
+	return solves, nil
+}
+
+// sortSolves puts solves in solve order
+func sortSolves(solves []EventSolve) {
+	sort.SliceStable(solves, func(i, j int) bool {
+		return solves[i].SolveNumber < solves[j].SolveNumber
+	})
+}
+
+// standingSolves returns the positions of the solves that are not withdrawn,
+// in solve order
+func standingSolves(solves []EventSolve) []int {
+	standing := []int{}
+	for i := range solves {
+		if !solves[i].Withdrawn {
+			standing = append(standing, i)
+		}
+	}
+	return standing
+}
+
+// awardVlab returns the points of a trainee's result: the dynamic award of
+// the event the result solved, if any, or what the scoring rules give
+func awardVlab(stub shim.ChaincodeStubInterface, rules *ScoringRules, traineeID string, vlab Vlab) (int, error) {
+	if vlab.EventID == "" || vlab.Result == "" {
+		return rules.awardResult(vlab)
+	}
+
+	event, err := getEventRecord(stub, rules.PlatformID, vlab.EventID)
+	if err != nil {
+		return 0, err
+	}
+	if event == nil || event.Scoring == nil {
+		return rules.award(vlab)
+	}
+
+	solves, err := eventVlabSolves(stub, event.PlatformID, event.EventID, vlab.VlabID)
+	if err != nil {
+		return 0, err
+	}
+	standing := standingSolves(solves)
+	for rank, i := range standing {
+		if solves[i].TraineeID == traineeID {
+			return dynamicAward(rules, event.Scoring, vlab, rank+1, len(standing))
+		}
+	}
+	return rules.award(vlab)
+}
+
+// rescoreEventVlab re-awards every standing solve of a vlab in a dynamically
+// scored event after the solve of trainee changed. solves holds the solves in
+// solve order with the trainee's already updated, since the transaction does
+// not read its own writes. vlab is the trainee's result; the other solvers'
+// records, leaderboard entries and platform copies are updated here.
+func rescoreEventVlab(stub shim.ChaincodeStubInterface, event *Event, solves []EventSolve, trainee *Trainee, platform *Platform, vlab *Vlab, rules *ScoringRules, at time.Time) error {
+	standing := standingSolves(solves)
+	for rank, i := range standing {
+		solve := &solves[i]
+
+		if solve.TraineeID == trainee.TraineeID {
+			points, err := dynamicAward(rules, event.Scoring, *vlab, rank+1, len(standing))
+			if err != nil {
+				return err
+			}
+			vlab.AwardedPoints = points
+			vlab.EventID = event.EventID
+			solve.update(event, at, vlab.Result, points, false)
+			continue
+		}
+
+		points, err := rescoreSolver(stub, event, solve, rank+1, len(standing), platform, rules, *vlab)
+		if err != nil {
+			return err
+		}
+		if points == solve.Points {
+			continue
+		}
+		solve.update(event, at, solve.Result, points, false)
+		err = putEventSolve(stub, event.PlatformID, solve)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range solves {
+		if solves[i].TraineeID == trainee.TraineeID {
+			return putEventSolve(stub, event.PlatformID, &solves[i])
+		}
+	}
+	return nil
+}
+
+// rescoreSolver returns the new points of another trainee's solve and, if the
+// trainee's result still stems from the event, updates the trainee's
+// experience points and transcript. scored is the vlab being scored, used for trainees who
+// no longer hold the vlab.
+func rescoreSolver(stub shim.ChaincodeStubInterface, event *Event, solve *EventSolve, rank int, solves int, platform *Platform, rules *ScoringRules, scored Vlab) (int, error) {
+	solver, err := getTraineeRecord(stub, solve.TraineeID)
+	if err != nil {
+		return 0, err
+	}
+
+	vlab, exists := solver.VlabPointsMap2[solve.VlabID]
+	tied := exists && vlab.EventID == event.EventID && solver.ActivePlatform == event.PlatformID
+	if !tied {
+		vlab = scored
+		vlab.Result = solve.Result
+		vlab.TimeSpent = ""
+		vlab.StartTime = nil
+		vlab.Deadline = nil
+		vlab.GradedAt = nil
+	}
+
+	points, err := dynamicAward(rules, event.Scoring, vlab, rank, solves)
+	if err != nil {
+		return 0, err
+	}
+	if !tied || vlab.AwardedPoints == points {
+		return points, nil
+	}
+
+	previous := *solver
+	vlab.AwardedPoints = points
+	solver.VlabPointsMap2[solve.VlabID] = vlab
+	err = recalculateExpPoints(stub, solver)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range platform.Trainees {
+		if platform.Trainees[i].TraineeID == solver.TraineeID {
+			platform.Trainees[i].VlabPointsMap2[solve.VlabID] = vlab
+			setExpPoints(&platform.Trainees[i], solver.TotalExpPoints)
+			platform.Trainees[i].Level = solver.Level
+			break
+		}
+	}
+
+	solverJSON, err := json.Marshal(solver)
+	if err != nil {
+		return 0, err
+	}
+	err = stub.PutState(solver.TraineeID, solverJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	// The re-award is a grade of its own in the solver's transcript, given by
+	// the event. Badges and certificates go by results, which it leaves alone.
+	err = updateTranscript(stub, solver.TraineeID, func(transcript *Transcript, at time.Time) {
+		transcript.grade(vlab, solver.ActivePlatform, event.EventID, at)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = updateLeaderboard(stub, &previous, solver)
+	if err != nil {
+		return 0, err
+	}
+
+	return points, emitExpPointsChange(stub, &previous, solver)
+}
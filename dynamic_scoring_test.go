@@ -0,0 +1,66 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestDynamicAward(t *testing.T) {
+	rules := defaultScoringRules("p1")
+	multiplied := defaultScoringRules("p1")
+	multiplied.DifficultyMultipliers = map[string]float64{"Hard": 2}
+	passFail := defaultScoringRules("p1")
+	passFail.ResultType = PassFailResultType
+	linear := &DynamicScoring{Curve: LinearDecay, MinimumFraction: 0.2, Decay: 4, FirstBloodBonuses: []int{50, 30}}
+	parabolic := &DynamicScoring{Curve: ParabolicDecay, MinimumFraction: 0.2, Decay: 4}
+
+	tests := []struct {
+		name    string
+		rules   *ScoringRules
+		scoring *DynamicScoring
+		vlab    Vlab
+		rank    int
+		solves  int
+		want    int
+		wantErr bool
+	}{
+		{"first blood", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 1, 1, 150, false},
+		{"second of two", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 2, 2, 110, false},
+		{"first of three", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 1, 3, 110, false},
+		{"no bonus left", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 3, 3, 60, false},
+		{"fully decayed", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 5, 5, 20, false},
+		{"past the decay", rules, linear, Vlab{ExpPoints: "100", Result: "100"}, 10, 10, 20, false},
+		{"partial result", rules, linear, Vlab{ExpPoints: "100", Result: "50"}, 3, 3, 30, false},
+		{"parabolic", rules, parabolic, Vlab{ExpPoints: "100", Result: "100"}, 3, 3, 80, false},
+		{"parabolic fully decayed", rules, parabolic, Vlab{ExpPoints: "100", Result: "100"}, 5, 5, 20, false},
+		{"difficulty multiplier", multiplied, linear, Vlab{ExpPoints: "100", BoxDifficulty: "Hard", Result: "100"}, 3, 3, 120, false},
+		{"pass", passFail, linear, Vlab{ExpPoints: "100", Result: "pass"}, 3, 3, 60, false},
+		{"ExpPoints not an integer", rules, linear, Vlab{ExpPoints: "lots", Result: "100"}, 1, 1, 0, true},
+		{"result the rules reject", rules, linear, Vlab{ExpPoints: "100", Result: "pass"}, 1, 1, 0, true},
+	}
+	for _, test := range tests {
+		got, err := dynamicAward(test.rules, test.scoring, test.vlab, test.rank, test.solves)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: dynamicAward error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: dynamicAward = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
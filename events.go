@@ -0,0 +1,446 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Fabric keeps a single chaincode event per transaction, the last SetEvent
+// wins. Functions therefore emit typed events into a buffer and Invoke sets
+// one chaincode event once the function succeeded. The chaincode event is
+// named after the first typed event and its payload is an EventEnvelope
+// holding all of them in the order they were emitted.
+
+// EventSchemaVersion is bumped whenever a payload below changes incompatibly.
+// New event types and new fields are compatible: consumers skip event types
+// they do not know and fields they do not read, so such changes keep the
+// version. Renaming or removing a field, changing its type or changing what
+// an existing value means needs a new version, and the projector's
+// supportedSchemaVersion must follow it.
+const EventSchemaVersion = 1
+
+// Event types
+const (
+	TraineeCreatedEventType             = "TraineeCreated"
+	TrainerCreatedEventType             = "TrainerCreated"
+	PlatformCreatedEventType            = "PlatformCreated"
+	VlabCreatedEventType                = "VlabCreated"
+	AdministratorCreatedEventType       = "AdministratorCreated"
+	VlabOwnerCreatedEventType           = "VlabOwnerCreated"
+	EntityDeletedEventType              = "EntityDeleted"
+	TraineeAddedToPlatformEventType     = "TraineeAddedToPlatform"
+	TraineeRemovedFromPlatformEventType = "TraineeRemovedFromPlatform"
+	TraineeTransferredEventType         = "TraineeTransferred"
+	VlabAddedToPlatformEventType        = "VlabAddedToPlatform"
+	VlabAssignedEventType               = "VlabAssigned"
+	VlabScoredEventType                 = "VlabScored"
+	ExpPointsRecalculatedEventType      = "ExpPointsRecalculated"
+	AssetsReindexedEventType            = "AssetsReindexed"
+	ScoringRulesSetEventType            = "ScoringRulesSet"
+	LevelUpEventType                    = "LevelUp"
+	LevelThresholdsSetEventType         = "LevelThresholdsSet"
+	BadgeCreatedEventType               = "BadgeCreated"
+	BadgeAwardedEventType               = "BadgeAwarded"
+	CertificateIssuedEventType          = "CertificateIssued"
+	CertificateRevokedEventType         = "CertificateRevoked"
+	IssuerProfileSetEventType           = "IssuerProfileSet"
+	VlabPrerequisitesSetEventType       = "VlabPrerequisitesSet"
+	LearningPathCreatedEventType        = "LearningPathCreated"
+	LearningPathEnrolledEventType       = "LearningPathEnrolled"
+	PathMilestoneReachedEventType       = "PathMilestoneReached"
+	LearningPathCompletedEventType      = "LearningPathCompleted"
+	TeamCreatedEventType                = "TeamCreated"
+	TeamMemberAddedEventType            = "TeamMemberAdded"
+	TeamMemberRemovedEventType          = "TeamMemberRemoved"
+	TeamMemberMovedEventType            = "TeamMemberMoved"
+	EventCreatedEventType               = "EventCreated"
+	DisputeOpenedEventType              = "DisputeOpened"
+	DisputeRespondedEventType           = "DisputeResponded"
+	DisputeResolvedEventType            = "DisputeResolved"
+	VlabRubricSetEventType              = "VlabRubricSet"
+	SeasonClosedEventType               = "SeasonClosed"
+	TokenTransferEventType              = "TokenTransfer"
+	TokenSettingsSetEventType           = "TokenSettingsSet"
+)
+
+// EventRecord is one typed event with its JSON payload
+type EventRecord struct {
+	Type    string
+	Payload json.RawMessage
+}
+
+// EventEnvelope is the payload of the chaincode event of a transaction
+type EventEnvelope struct {
+	SchemaVersion int
+	TxID          string
+	Timestamp     time.Time
+	Events        []EventRecord
+}
+
+// TraineeCreatedEvent is emitted by createTrainee
+type TraineeCreatedEvent struct {
+	TraineeID string
+	Trainee   Trainee
+}
+
+// TrainerCreatedEvent is emitted by createTrainer
+type TrainerCreatedEvent struct {
+	TrainerID string
+	Trainer   Trainer
+}
+
+// PlatformCreatedEvent is emitted by createPlatform
+type PlatformCreatedEvent struct {
+	PlatformID string
+	Platform   Platform
+}
+
+// VlabCreatedEvent is emitted by createVlab
+type VlabCreatedEvent struct {
+	VlabOwnerID string
+	VlabID      string
+	Vlab        Vlab
+}
+
+// AdministratorCreatedEvent is emitted by createAdministrator
+type AdministratorCreatedEvent struct {
+	AdministratorID string
+	Administrator   Administrator
+}
+
+// VlabOwnerCreatedEvent is emitted by createVlabOwner
+type VlabOwnerCreatedEvent struct {
+	VlabOwnerID string
+	VlabOwner   VlabOwner
+}
+
+// EntityDeletedEvent is emitted by delete. EntityType is empty when the
+// deleted key did not hold a known entity.
+type EntityDeletedEvent struct {
+	ID         string
+	EntityType string
+}
+
+// TraineeAddedToPlatformEvent is emitted by addTraineeToPlatform
+type TraineeAddedToPlatformEvent struct {
+	AdministratorID string
+	TraineeID       string
+	PlatformID      string
+}
+
+// TraineeRemovedFromPlatformEvent is emitted by deleteTraineeFromPlatform
+type TraineeRemovedFromPlatformEvent struct {
+	AdministratorID string
+	TraineeID       string
+	PlatformID      string
+}
+
+// TraineeTransferredEvent is emitted by TransferTrainee1. DroppedVlabIDs
+// lists the vlabs the new platform lacks.
+type TraineeTransferredEvent struct {
+	AdministratorID string
+	TraineeID       string
+	FromPlatformID  string
+	ToPlatformID    string
+	DroppedVlabIDs  []string
+}
+
+// VlabAddedToPlatformEvent is emitted by addVlabToPlatform
+type VlabAddedToPlatformEvent struct {
+	AdministratorID string
+	VlabID          string
+	PlatformID      string
+}
+
+// VlabAssignedEvent is emitted by addVlabToTrainee
+type VlabAssignedEvent struct {
+	TraineeID  string
+	VlabID     string
+	PlatformID string
+	StartTime  *time.Time `json:"StartTime,omitempty"`
+	Deadline   *time.Time `json:"Deadline,omitempty"`
+}
+
+// VlabScoredEvent is emitted by ScoreTheVlab and removeVlabScore, which
+// leaves ResultAfter empty
+type VlabScoredEvent struct {
+	TrainerID     string
+	TraineeID     string
+	VlabID        string
+	PlatformID    string
+	ResultBefore  string
+	ResultAfter   string
+	AwardedPoints int
+}
+
+// ExpPointsRecalculatedEvent is emitted whenever a trainee's total changes
+type ExpPointsRecalculatedEvent struct {
+	TraineeID  string
+	PlatformID string
+	Before     int
+	After      int
+}
+
+// AssetsReindexedEvent is emitted by reindexAssets
+type AssetsReindexedEvent struct {
+	AdministratorID string
+	StartKey        string
+	NextKey         string
+}
+
+// ScoringRulesSetEvent is emitted by setScoringRules
+type ScoringRulesSetEvent struct {
+	AdministratorID string
+	Rules           ScoringRules
+}
+
+// LevelUpEvent is emitted when a trainee's points cross a level threshold
+// upwards
+type LevelUpEvent struct {
+	TraineeID      string
+	PlatformID     string
+	PreviousLevel  string
+	Level          string
+	TotalExpPoints int
+}
+
+// LevelThresholdsSetEvent is emitted by setLevelThresholds
+type LevelThresholdsSetEvent struct {
+	AdministratorID string
+	Levels          []Level
+}
+
+// BadgeCreatedEvent is emitted by createBadge
+type BadgeCreatedEvent struct {
+	AdministratorID string
+	Badge           Badge
+}
+
+// BadgeAwardedEvent is emitted when a trainee earns a badge
+type BadgeAwardedEvent struct {
+	BadgeID    string
+	TraineeID  string
+	PlatformID string
+}
+
+// CertificateIssuedEvent is emitted when a trainee completes a platform's
+// vlab catalogue or a learning path
+type CertificateIssuedEvent struct {
+	CertificateID string
+	TraineeID     string
+	PlatformID    string
+	PathID        string `json:"PathID,omitempty"`
+	ContentHash   string
+}
+
+// CertificateRevokedEvent is emitted by revokeCertificate
+type CertificateRevokedEvent struct {
+	AdministratorID string
+	CertificateID   string
+	TraineeID       string
+	Reason          string
+}
+
+// IssuerProfileSetEvent is emitted by setIssuerProfile
+type IssuerProfileSetEvent struct {
+	AdministratorID string
+	Profile         IssuerProfile
+}
+
+// VlabPrerequisitesSetEvent is emitted by setVlabPrerequisites
+type VlabPrerequisitesSetEvent struct {
+	CallerID      string
+	VlabID        string
+	Prerequisites []string
+}
+
+// LearningPathCreatedEvent is emitted by createLearningPath
+type LearningPathCreatedEvent struct {
+	AdministratorID string
+	Path            LearningPath
+}
+
+// LearningPathEnrolledEvent is emitted by enrollInLearningPath
+type LearningPathEnrolledEvent struct {
+	CallerID   string
+	TraineeID  string
+	PlatformID string
+	PathID     string
+}
+
+// PathMilestoneReachedEvent is emitted when a trainee passes a step of a
+// learning path that marks a milestone
+type PathMilestoneReachedEvent struct {
+	TraineeID  string
+	PlatformID string
+	PathID     string
+	Milestone  string
+}
+
+// LearningPathCompletedEvent is emitted when a trainee passes the last step
+// of a learning path
+type LearningPathCompletedEvent struct {
+	TraineeID     string
+	PlatformID    string
+	PathID        string
+	CertificateID string `json:"CertificateID,omitempty"`
+}
+
+// TeamCreatedEvent is emitted by createTeam
+type TeamCreatedEvent struct {
+	CallerID string
+	Team     Team
+}
+
+// TeamMemberEvent is emitted when a trainee joins or leaves a team, including
+// by leaving the team's platform
+type TeamMemberEvent struct {
+	CallerID   string
+	PlatformID string
+	TeamID     string
+	TraineeID  string
+}
+
+// TeamMemberMovedEvent is emitted by moveTeamMember
+type TeamMemberMovedEvent struct {
+	CallerID   string
+	PlatformID string
+	TraineeID  string
+	FromTeamID string
+	ToTeamID   string
+}
+
+// EventCreatedEvent is emitted by createEvent
+type EventCreatedEvent struct {
+	AdministratorID string
+	Event           Event
+}
+
+// DisputeOpenedEvent is emitted by openDispute
+type DisputeOpenedEvent struct {
+	DisputeID      string
+	TraineeID      string
+	VlabID         string
+	PlatformID     string
+	DisputedResult string
+}
+
+// DisputeRespondedEvent is emitted by respondToDispute
+type DisputeRespondedEvent struct {
+	DisputeID string
+	AuthorID  string
+}
+
+// DisputeResolvedEvent is emitted by resolveDispute. An upheld dispute also
+// emits the events of the corrected result.
+type DisputeResolvedEvent struct {
+	DisputeID       string
+	ResolverID      string
+	TraineeID       string
+	VlabID          string
+	Outcome         string
+	CorrectedResult string `json:"CorrectedResult,omitempty"`
+}
+
+// VlabRubricSetEvent is emitted by setVlabRubric. Rubric is null when the
+// rubric was removed.
+type VlabRubricSetEvent struct {
+	CallerID string
+	VlabID   string
+	Rubric   *Rubric
+}
+
+// SeasonClosedEvent is emitted by closeSeason. The trainees' new totals are
+// emitted as ExpPointsRecalculated events.
+type SeasonClosedEvent struct {
+	AdministratorID string
+	PlatformID      string
+	Season          int
+	Name            string `json:"Name,omitempty"`
+	CarryOver       float64
+	Trainees        int
+}
+
+// TokenSettingsSetEvent is emitted by setTokenTransfers
+type TokenSettingsSetEvent struct {
+	AdministratorID string
+	Settings        TokenSettings
+}
+
+// eventStub buffers the typed events of one invocation. It also remembers
+// whether the invocation logged a token operation, as Fabric does not let a
+// transaction read its own writes.
+type eventStub struct {
+	shim.ChaincodeStubInterface
+	events      []EventRecord
+	tokenLogged bool
+}
+
+// emitEvent adds a typed event to the transaction's chaincode event
+func emitEvent(stub shim.ChaincodeStubInterface, eventType string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	record := EventRecord{
+		Type:    eventType,
+		Payload: payloadJSON,
+	}
+
+	if events, ok := stub.(*eventStub); ok {
+		events.events = append(events.events, record)
+		return nil
+	}
+
+	// Not called through Invoke, set the event right away
+	return setEvents(stub, []EventRecord{record})
+}
+
+// flushEvents sets the buffered events as the transaction's chaincode event
+func (stub *eventStub) flushEvents() error {
+	if len(stub.events) == 0 {
+		return nil
+	}
+	return setEvents(stub.ChaincodeStubInterface, stub.events)
+}
+
+// setEvents wraps the events in an envelope and sets the chaincode event
+func setEvents(stub shim.ChaincodeStubInterface, events []EventRecord) error {
+	timestamp, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	envelope := EventEnvelope{
+		SchemaVersion: EventSchemaVersion,
+		TxID:          stub.GetTxID(),
+		Timestamp:     timestamp,
+		Events:        events,
+	}
+
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return stub.SetEvent(events[0].Type, envelopeJSON)
+}
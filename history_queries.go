@@ -0,0 +1,313 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// History queries need core.ledger.history.enableHistoryDatabase on the peer.
+// Versions are returned newest first, the order GetHistoryForKey uses.
+
+// HistoryEntry is one version of an entity
+type HistoryEntry struct {
+	TxID      string
+	Timestamp time.Time
+	IsDelete  bool
+	Value     interface{}
+}
+
+// FieldChange is one field that differs between two consecutive versions.
+// Nested objects are flattened, so a score change shows up as
+// "Trainee_vlabs.<vlabID>.Result".
+type FieldChange struct {
+	Field  string
+	Before json.RawMessage
+	After  json.RawMessage
+}
+
+// HistoryDiff lists the fields a transaction changed compared to the
+// version before it
+type HistoryDiff struct {
+	TxID      string
+	Timestamp time.Time
+	IsDelete  bool
+	Changes   []FieldChange
+}
+
+// historyVersion is a raw version read from the history database
+type historyVersion struct {
+	TxID      string
+	Timestamp time.Time
+	IsDelete  bool
+	Value     []byte
+}
+
+// readHistory returns every version of a key, newest first
+func readHistory(stub shim.ChaincodeStubInterface, key string) ([]historyVersion, error) {
+	resultsIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	versions := []historyVersion{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		version := historyVersion{
+			TxID:     modification.TxId,
+			IsDelete: modification.IsDelete,
+			Value:    modification.Value,
+		}
+		if modification.Timestamp != nil {
+			version.Timestamp = modification.Timestamp.AsTime()
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// checkVersions fails unless every stored version of id is an entity of
+// objectType, so that another entity's history is not read as one
+func checkVersions(objectType string, id string, versions []historyVersion) error {
+	for _, version := range versions {
+		if version.IsDelete || len(version.Value) == 0 {
+			continue
+		}
+		if objectTypeOf(version.Value) != objectType {
+			return fmt.Errorf("%s is not a %s", id, objectType)
+		}
+	}
+	return nil
+}
+
+// decodeVersion unmarshals a stored version into its typed entity
+func decodeVersion(objectType string, version historyVersion) (interface{}, error) {
+	if version.IsDelete || len(version.Value) == 0 {
+		return nil, nil
+	}
+
+	record, err := newObject(objectType)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(version.Value, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// flattenJSON maps every leaf of a JSON document to its dotted path.
+// Arrays are kept as leaves.
+func flattenJSON(prefix string, value json.RawMessage, fields map[string]json.RawMessage) {
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &object); err != nil {
+		if prefix != "" {
+			fields[prefix] = value
+		}
+		return
+	}
+
+	for key, child := range object {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		flattenJSON(path, child, fields)
+	}
+}
+
+// diffVersions returns the fields that differ between two stored values
+func diffVersions(before []byte, after []byte) []FieldChange {
+	beforeFields := map[string]json.RawMessage{}
+	afterFields := map[string]json.RawMessage{}
+	if len(before) > 0 {
+		flattenJSON("", before, beforeFields)
+	}
+	if len(after) > 0 {
+		flattenJSON("", after, afterFields)
+	}
+
+	paths := []string{}
+	for path := range beforeFields {
+		paths = append(paths, path)
+	}
+	for path := range afterFields {
+		if _, exists := beforeFields[path]; !exists {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []FieldChange{}
+	for _, path := range paths {
+		if !bytes.Equal(beforeFields[path], afterFields[path]) {
+			changes = append(changes, FieldChange{
+				Field:  path,
+				Before: beforeFields[path],
+				After:  afterFields[path],
+			})
+		}
+	}
+	return changes
+}
+
+// getHistory returns the versions of an entity.
+// Arguments: entityType, ID, optional mode ("versions" or "diff")
+func (t *SimpleChaincode) getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting entityType, ID and optional mode")
+	}
+
+	entityType := args[0]
+	id := args[1]
+	mode := "versions"
+	if len(args) == 3 {
+		mode = args[2]
+	}
+
+	if _, err := newObject(entityType); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	versions, err := readHistory(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkVersions(entityType, id, versions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var result interface{}
+	if mode == "versions" {
+		entries := []HistoryEntry{}
+		for _, version := range versions {
+			value, err := decodeVersion(entityType, version)
+			if err != nil {
+				return shim.Error("Failed to unmarshal " + entityType + " version " + version.TxID)
+			}
+			entries = append(entries, HistoryEntry{
+				TxID:      version.TxID,
+				Timestamp: version.Timestamp,
+				IsDelete:  version.IsDelete,
+				Value:     value,
+			})
+		}
+		result = entries
+	} else if mode == "diff" {
+		diffs := []HistoryDiff{}
+		for i, version := range versions {
+			// The previous version is the next one in newest-first order
+			var before []byte
+			if i+1 < len(versions) {
+				before = versions[i+1].Value
+			}
+			diffs = append(diffs, HistoryDiff{
+				TxID:      version.TxID,
+				Timestamp: version.Timestamp,
+				IsDelete:  version.IsDelete,
+				Changes:   diffVersions(before, version.Value),
+			})
+		}
+		result = diffs
+	} else {
+		return shim.Error("Unknown history mode " + mode + ". Expecting versions or diff")
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to marshal history to JSON")
+	}
+
+	return shim.Success(resultJSON)
+}
+
+// getAsOf returns the version of an entity that was current at the given time
+func getAsOf(stub shim.ChaincodeStubInterface, objectType string, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting ID and an RFC3339 timestamp")
+	}
+
+	id := args[0]
+	asOf, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("Failed to parse timestamp " + args[1] + ". Expecting RFC3339")
+	}
+
+	versions, err := readHistory(stub, id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkVersions(objectType, id, versions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Versions are newest first, so the first one not after asOf was current then
+	for _, version := range versions {
+		if version.Timestamp.After(asOf) {
+			continue
+		}
+		if version.IsDelete {
+			break
+		}
+
+		value, err := decodeVersion(objectType, version)
+		if err != nil {
+			return shim.Error("Failed to unmarshal " + objectType + " version " + version.TxID)
+		}
+
+		entryJSON, err := json.Marshal(HistoryEntry{
+			TxID:      version.TxID,
+			Timestamp: version.Timestamp,
+			IsDelete:  version.IsDelete,
+			Value:     value,
+		})
+		if err != nil {
+			return shim.Error("Failed to marshal history to JSON")
+		}
+		return shim.Success(entryJSON)
+	}
+
+	return shim.Error(objectType + " " + id + " did not exist at " + args[1])
+}
+
+func (t *SimpleChaincode) getTraineeAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return getAsOf(stub, traineeObjectType, args)
+}
+
+func (t *SimpleChaincode) getPlatformAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return getAsOf(stub, platformObjectType, args)
+}
+
+func (t *SimpleChaincode) getVlabAsOf(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return getAsOf(stub, vlabObjectType, args)
+}
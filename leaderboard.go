@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The leaderboard is a maintained index of composite keys
+//
+//	leaderboard \x00 platformID \x00 invertedPoints \x00 lastCompletion \x00 traineeID \x00
+//
+// so that a partial key query on the platform returns trainees already ranked:
+// most experience points first, ties broken by the earlier last completion.
+const leaderboardObjectType = "leaderboard"
+
+// noCompletion sorts trainees that never completed a vlab after everyone
+// else with the same points
+const noCompletion = "9999-12-31T23:59:59.999999999Z"
+
+// LeaderboardEntry is the value stored under a leaderboard key
+type LeaderboardEntry struct {
+	TraineeID      string
+	Nickname       string
+	TotalExpPoints int
+	Level          string
+	LastCompletion time.Time
+}
+
+// leaderboardKey returns the ranking key of a trainee on its active platform
+func leaderboardKey(stub shim.ChaincodeStubInterface, trainee *Trainee) (string, error) {
+	points := int64(trainee.TotalExpPoints)
+	if points < 0 {
+		points = 0
+	}
+	invertedPoints := fmt.Sprintf("%019d", math.MaxInt64-points)
+
+	lastCompletion := noCompletion
+	if !trainee.LastCompletion.IsZero() {
+		lastCompletion = trainee.LastCompletion.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	}
+
+	return stub.CreateCompositeKey(leaderboardObjectType, []string{trainee.ActivePlatform, invertedPoints, lastCompletion, trainee.TraineeID})
+}
+
+// updateLeaderboard moves a trainee's leaderboard entry from its previous
+// state to its current one. Either state may be off any platform.
+func updateLeaderboard(stub shim.ChaincodeStubInterface, previous *Trainee, current *Trainee) error {
+	previousKey := ""
+	if previous != nil && previous.ActivePlatform != "" {
+		key, err := leaderboardKey(stub, previous)
+		if err != nil {
+			return err
+		}
+		previousKey = key
+	}
+
+	currentKey := ""
+	if current != nil && current.ActivePlatform != "" {
+		key, err := leaderboardKey(stub, current)
+		if err != nil {
+			return err
+		}
+		currentKey = key
+	}
+
+	if previousKey != "" && previousKey != currentKey {
+		err := stub.DelState(previousKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if currentKey != "" {
+		entry := LeaderboardEntry{
+			TraineeID:      current.TraineeID,
+			Nickname:       current.Nickname,
+			TotalExpPoints: current.TotalExpPoints,
+			Level:          current.Level,
+			LastCompletion: current.LastCompletion,
+		}
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(currentKey, entryJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLeaderboard returns one page of a platform's ranked trainees.
+// Arguments: platformID, limit, optional bookmark
+func (t *SimpleChaincode) getLeaderboard(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID, limit and optional bookmark")
+	}
+
+	platformID := args[0]
+	pageSize, bookmark, err := parsePagination(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check if Platform exists
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("PlatformID does not exist")
+	}
+
+	resultsIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(leaderboardObjectType, []string{platformID}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []interface{}{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entry := LeaderboardEntry{}
+		err = json.Unmarshal(queryResult.Value, &entry)
+		if err != nil {
+			return shim.Error("Failed to unmarshal leaderboard entry JSON")
+		}
+		records = append(records, entry)
+	}
+
+	result := PaginatedQueryResult{
+		PageSize:            pageSize,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+		Records:             records,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to marshal leaderboard to JSON")
+	}
+
+	return shim.Success(resultJSON)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// leaderboardEntries returns the leaderboard of a platform in rank order as
+// traineeID:points
+func leaderboardEntries(t *testing.T, stub *testStub, platformID string) []string {
+	t.Helper()
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(leaderboardObjectType, []string{platformID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resultsIterator.Close()
+
+	entries := []string{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := LeaderboardEntry{}
+		err = json.Unmarshal(queryResult.Value, &entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, fmt.Sprintf("%s:%d", entry.TraineeID, entry.TotalExpPoints))
+	}
+	return entries
+}
+
+func TestUpdateLeaderboard(t *testing.T) {
+	stub := newTestStub()
+	early := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	trainee := func(traineeID string, platformID string, points int, lastCompletion time.Time) *Trainee {
+		return &Trainee{TraineeID: traineeID, ActivePlatform: platformID, TotalExpPoints: points, LastCompletion: lastCompletion}
+	}
+
+	tests := []struct {
+		name      string
+		traineeID string
+		current   *Trainee
+		p1        []string
+		p2        []string
+	}{
+		{"first trainee", "t1", trainee("t1", "p1", 100, late), []string{"t1:100"}, []string{}},
+		{"tie broken by earlier completion", "t2", trainee("t2", "p1", 100, early), []string{"t2:100", "t1:100"}, []string{}},
+		{"never completed", "t3", trainee("t3", "p1", 0, time.Time{}), []string{"t2:100", "t1:100", "t3:0"}, []string{}},
+		{"more points", "t1", trainee("t1", "p1", 300, late), []string{"t1:300", "t2:100", "t3:0"}, []string{}},
+		{"unchanged", "t1", trainee("t1", "p1", 300, late), []string{"t1:300", "t2:100", "t3:0"}, []string{}},
+		{"negative points rank as none", "t3", trainee("t3", "p1", -20, time.Time{}), []string{"t1:300", "t2:100", "t3:-20"}, []string{}},
+		{"platform change", "t2", trainee("t2", "p2", 100, early), []string{"t1:300", "t3:-20"}, []string{"t2:100"}},
+		{"off any platform", "t3", trainee("t3", "", 0, time.Time{}), []string{"t1:300"}, []string{"t2:100"}},
+		{"removed", "t2", nil, []string{"t1:300"}, []string{}},
+		{"back on a platform", "t3", trainee("t3", "p2", 50, late), []string{"t1:300"}, []string{"t3:50"}},
+	}
+	trainees := map[string]*Trainee{}
+	for _, test := range tests {
+		stub.startTransaction()
+		err := updateLeaderboard(stub, trainees[test.traineeID], test.current)
+		stub.MockTransactionEnd("")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		trainees[test.traineeID] = test.current
+
+		for platformID, want := range map[string][]string{"p1": test.p1, "p2": test.p2} {
+			got := leaderboardEntries(t, stub, platformID)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s: leaderboard of %s = %v, want %v", test.name, platformID, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,614 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Learning paths live under two composite keys
+//
+//	learningpath \x00 platformID \x00 pathID \x00
+//	pathenrollment \x00 traineeID \x00 platformID \x00 pathID \x00
+//
+// An enrollment points at the first step the trainee has not passed. That
+// step's vlab is assigned as soon as its prerequisites are met, and passing
+// it moves the enrollment on. The steps advance in the transaction that
+// records the result, on the trainee and platform it already holds, since a
+// transaction does not read its own writes.
+const (
+	learningPathObjectType   = "learningpath"
+	pathEnrollmentObjectType = "pathenrollment"
+)
+
+// PathStep is one vlab of a learning path. Passing a step with a Milestone
+// reaches the milestone.
+type PathStep struct {
+	VlabID    string
+	Milestone string `json:"Milestone,omitempty"`
+}
+
+// LearningPath is an ordered sequence of vlabs of a platform's catalogue
+type LearningPath struct {
+	DocType          string `json:"docType"`
+	PathID           string
+	PlatformID       string
+	Name             string
+	Description      string
+	Steps            []PathStep
+	IssueCertificate bool
+	CreatedBy        string
+}
+
+// ReachedMilestone is a milestone of a learning path a trainee reached
+type ReachedMilestone struct {
+	Name      string
+	ReachedAt time.Time
+}
+
+// PathEnrollment is a trainee's progress along a learning path
+type PathEnrollment struct {
+	DocType       string `json:"docType"`
+	TraineeID     string
+	PlatformID    string
+	PathID        string
+	CurrentStep   int
+	Milestones    []ReachedMilestone
+	EnrolledAt    time.Time
+	CompletedAt   *time.Time `json:"CompletedAt,omitempty"`
+	CertificateID string     `json:"CertificateID,omitempty"`
+}
+
+// getLearningPathRecord reads a learning path, or nil if it does not exist
+func getLearningPathRecord(stub shim.ChaincodeStubInterface, platformID string, pathID string) (*LearningPath, error) {
+	pathKey, err := stub.CreateCompositeKey(learningPathObjectType, []string{platformID, pathID})
+	if err != nil {
+		return nil, err
+	}
+
+	pathBytes, err := stub.GetState(pathKey)
+	if err != nil {
+		return nil, err
+	}
+	if pathBytes == nil {
+		return nil, nil
+	}
+
+	path := &LearningPath{}
+	err = json.Unmarshal(pathBytes, path)
+	if err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// putEnrollment saves a trainee's enrollment in a learning path
+func putEnrollment(stub shim.ChaincodeStubInterface, enrollment *PathEnrollment) error {
+	enrollmentJSON, err := json.Marshal(enrollment)
+	if err != nil {
+		return err
+	}
+
+	enrollmentKey, err := stub.CreateCompositeKey(pathEnrollmentObjectType, []string{enrollment.TraineeID, enrollment.PlatformID, enrollment.PathID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(enrollmentKey, enrollmentJSON)
+}
+
+// assignVlab adds a vlab to a trainee and to the trainee's copy in the
+// platform
+func assignVlab(trainee *Trainee, platform *Platform, vlab Vlab) {
+	trainee.VlabPointsMap2[vlab.VlabID] = vlab
+	for i := range platform.Trainees {
+		if platform.Trainees[i].TraineeID == trainee.TraineeID {
+			platform.Trainees[i].VlabPointsMap2[vlab.VlabID] = vlab
+			break
+		}
+	}
+}
+
+// advanceEnrollment moves an enrollment past the steps the trainee passed
+// under the platform's scoring rules and assigns the vlab of the step it stops at. It returns the vlabs it
+// assigned and whether the enrollment changed.
+func advanceEnrollment(stub shim.ChaincodeStubInterface, enrollment *PathEnrollment, path *LearningPath, trainee *Trainee, platform *Platform) ([]Vlab, bool, error) {
+	at, err := getTxTime(stub)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rules, err := getScoringRulesRecord(stub, platform.PlatformID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	assigned := []Vlab{}
+	changed := false
+	for enrollment.CurrentStep < len(path.Steps) {
+		step := path.Steps[enrollment.CurrentStep]
+
+		vlab, exists := trainee.VlabPointsMap2[step.VlabID]
+		if exists && rules.passes(vlab) {
+			if step.Milestone != "" {
+				enrollment.Milestones = append(enrollment.Milestones, ReachedMilestone{
+					Name:      step.Milestone,
+					ReachedAt: at,
+				})
+				err = emitEvent(stub, PathMilestoneReachedEventType, PathMilestoneReachedEvent{
+					TraineeID:  trainee.TraineeID,
+					PlatformID: path.PlatformID,
+					PathID:     path.PathID,
+					Milestone:  step.Milestone,
+				})
+				if err != nil {
+					return nil, false, err
+				}
+			}
+			enrollment.CurrentStep++
+			changed = true
+			continue
+		}
+
+		// Assign the step unless it already is or its prerequisites are
+		// still missing
+		if !exists {
+			record, err := getVlabRecord(stub, step.VlabID)
+			if err != nil {
+				return nil, false, err
+			}
+			missing, err := missingPrerequisites(stub, trainee, record)
+			if err != nil {
+				return nil, false, err
+			}
+			if len(missing) == 0 {
+				assignVlab(trainee, platform, *record)
+				assigned = append(assigned, *record)
+				err = emitEvent(stub, VlabAssignedEventType, VlabAssignedEvent{
+					TraineeID:  trainee.TraineeID,
+					VlabID:     record.VlabID,
+					PlatformID: platform.PlatformID,
+				})
+				if err != nil {
+					return nil, false, err
+				}
+			}
+		}
+		break
+	}
+
+	if enrollment.CurrentStep == len(path.Steps) && enrollment.CompletedAt == nil {
+		enrollment.CompletedAt = &at
+		changed = true
+
+		if path.IssueCertificate {
+			enrollment.CertificateID, err = issuePathCertificate(stub, trainee, platform, path)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		err = emitEvent(stub, LearningPathCompletedEventType, LearningPathCompletedEvent{
+			TraineeID:     trainee.TraineeID,
+			PlatformID:    path.PlatformID,
+			PathID:        path.PathID,
+			CertificateID: enrollment.CertificateID,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return assigned, changed, nil
+}
+
+// issuePathCertificate issues the certificate of a completed learning path
+// unless the trainee already holds one. It returns the certificate ID.
+func issuePathCertificate(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform, path *LearningPath) (string, error) {
+	issuedKey, err := stub.CreateCompositeKey(certificateIssuedObjectType, []string{trainee.TraineeID, platform.PlatformID, path.PathID})
+	if err != nil {
+		return "", err
+	}
+	issuedBytes, err := stub.GetState(issuedKey)
+	if err != nil {
+		return "", err
+	}
+	if issuedBytes != nil {
+		return string(issuedBytes), nil
+	}
+
+	vlabIDs := []string{}
+	for _, step := range path.Steps {
+		vlabIDs = append(vlabIDs, step.VlabID)
+	}
+
+	certificate, err := newCertificate(stub, trainee, platform, vlabIDs)
+	if err != nil {
+		return "", err
+	}
+	certificate.PathID = path.PathID
+	certificate.PathName = path.Name
+
+	err = storeCertificate(stub, certificate, issuedKey)
+	if err != nil {
+		return "", err
+	}
+	return certificate.CertificateID, nil
+}
+
+// syncLearningPaths advances the trainee's unfinished enrollments on the
+// platform. The caller saves the trainee and platform and records the
+// returned vlabs as assigned in the transcript.
+func syncLearningPaths(stub shim.ChaincodeStubInterface, trainee *Trainee, platform *Platform) ([]Vlab, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(pathEnrollmentObjectType, []string{trainee.TraineeID, platform.PlatformID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assigned := []Vlab{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		enrollment := PathEnrollment{}
+		err = json.Unmarshal(queryResult.Value, &enrollment)
+		if err != nil {
+			return nil, err
+		}
+		if enrollment.CompletedAt != nil {
+			continue
+		}
+
+		path, err := getLearningPathRecord(stub, enrollment.PlatformID, enrollment.PathID)
+		if err != nil {
+			return nil, err
+		}
+		if path == nil {
+			continue
+		}
+
+		vlabs, changed, err := advanceEnrollment(stub, &enrollment, path, trainee, platform)
+		if err != nil {
+			return nil, err
+		}
+		assigned = append(assigned, vlabs...)
+		if changed {
+			err = putEnrollment(stub, &enrollment)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return assigned, nil
+}
+
+// createLearningPath attaches a learning path to a platform. Every step must
+// be a vlab of the platform's catalogue.
+// Arguments: administratorID, platformID, pathID, name, description, steps JSON, optional issueCertificate
+// e.g. [{"VlabID":"vlab1"},{"VlabID":"vlab2","Milestone":"Web basics"}]
+func (t *SimpleChaincode) createLearningPath(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 6 && len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID, pathID, name, description, steps and optional issueCertificate")
+	}
+
+	administratorID := args[0]
+	platformID := args[1]
+	pathID := args[2]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+	if pathID == "" {
+		return shim.Error("pathID must not be empty")
+	}
+
+	issueCertificate := false
+	if len(args) == 7 {
+		var err error
+		issueCertificate, err = strconv.ParseBool(args[6])
+		if err != nil {
+			return shim.Error("issueCertificate must be true or false")
+		}
+	}
+
+	// Get the platform from the ledger
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+	var platform Platform
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check if the learning path already exists
+	existing, err := getLearningPathRecord(stub, platformID, pathID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Learning path already exists")
+	}
+
+	steps := []PathStep{}
+	err = json.Unmarshal([]byte(args[5]), &steps)
+	if err != nil {
+		return shim.Error("Failed to unmarshal learning path steps JSON")
+	}
+	if len(steps) == 0 {
+		return shim.Error("A learning path needs at least one step")
+	}
+
+	catalogue := map[string]bool{}
+	for _, vlab := range platform.Vlabs {
+		catalogue[vlab.VlabID] = true
+	}
+	seen := map[string]bool{}
+	for _, step := range steps {
+		if !catalogue[step.VlabID] {
+			return shim.Error(fmt.Sprintf("Vlab %s is not in the catalogue of platform %s", step.VlabID, platformID))
+		}
+		if seen[step.VlabID] {
+			return shim.Error(fmt.Sprintf("Vlab %s appears twice in the learning path", step.VlabID))
+		}
+		seen[step.VlabID] = true
+	}
+
+	path := LearningPath{
+		DocType:          learningPathObjectType,
+		PathID:           pathID,
+		PlatformID:       platformID,
+		Name:             args[3],
+		Description:      args[4],
+		Steps:            steps,
+		IssueCertificate: issueCertificate,
+		CreatedBy:        administratorID,
+	}
+
+	pathJSON, err := json.Marshal(path)
+	if err != nil {
+		return shim.Error("Failed to marshal learning path to JSON")
+	}
+
+	pathKey, err := stub.CreateCompositeKey(learningPathObjectType, []string{platformID, pathID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(pathKey, pathJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, LearningPathCreatedEventType, LearningPathCreatedEvent{
+		AdministratorID: administratorID,
+		Path:            path,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// listLearningPaths returns the learning paths of a platform.
+// Arguments: platformID
+func (t *SimpleChaincode) listLearningPaths(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(learningPathObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	paths := []LearningPath{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		path := LearningPath{}
+		err = json.Unmarshal(queryResult.Value, &path)
+		if err != nil {
+			return shim.Error("Failed to unmarshal learning path JSON")
+		}
+		paths = append(paths, path)
+	}
+
+	pathsJSON, err := json.Marshal(paths)
+	if err != nil {
+		return shim.Error("Failed to marshal learning paths to JSON")
+	}
+
+	return shim.Success(pathsJSON)
+}
+
+// enrollInLearningPath enrolls a trainee in a learning path of the trainee's
+// platform and assigns the first step not passed yet.
+// Arguments: administratorID or trainerID, traineeID, pathID
+func (t *SimpleChaincode) enrollInLearningPath(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID or trainerID, traineeID and pathID")
+	}
+
+	callerID := args[0]
+	traineeID := args[1]
+	pathID := args[2]
+
+	// Check if callerID starts with "admin" or "Trainer"
+	if !strings.HasPrefix(callerID, "admin") && !strings.HasPrefix(callerID, "Trainer") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	trainee, err := getTraineeRecord(stub, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if trainee.ActivePlatform == "" {
+		return shim.Error("Trainee need to be registered in platform in order to enroll in a learning path")
+	}
+
+	path, err := getLearningPathRecord(stub, trainee.ActivePlatform, pathID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if path == nil {
+		return shim.Error("Learning path " + pathID + " does not exist on platform " + trainee.ActivePlatform)
+	}
+
+	enrollmentKey, err := stub.CreateCompositeKey(pathEnrollmentObjectType, []string{traineeID, path.PlatformID, pathID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	enrollmentBytes, err := stub.GetState(enrollmentKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if enrollmentBytes != nil {
+		return shim.Error("Trainee is already enrolled in that learning path")
+	}
+
+	// Get the trainee's platform from the ledger
+	platformBytes, err := stub.GetState(trainee.ActivePlatform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var platform Platform
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	enrolledAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	enrollment := PathEnrollment{
+		DocType:    pathEnrollmentObjectType,
+		TraineeID:  traineeID,
+		PlatformID: path.PlatformID,
+		PathID:     pathID,
+		Milestones: []ReachedMilestone{},
+		EnrolledAt: enrolledAt,
+	}
+
+	err = emitEvent(stub, LearningPathEnrolledEventType, LearningPathEnrolledEvent{
+		CallerID:   callerID,
+		TraineeID:  traineeID,
+		PlatformID: path.PlatformID,
+		PathID:     pathID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	assigned, _, err := advanceEnrollment(stub, &enrollment, path, trainee, &platform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = putEnrollment(stub, &enrollment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(assigned) > 0 {
+		traineeJSON, err := json.Marshal(trainee)
+		if err != nil {
+			return shim.Error("Failed to marshal trainee to JSON")
+		}
+		err = stub.PutState(traineeID, traineeJSON)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		platformJSON, err := json.Marshal(platform)
+		if err != nil {
+			return shim.Error("Failed to marshal platform to JSON")
+		}
+		err = stub.PutState(platform.PlatformID, platformJSON)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// Record the attempts in the trainee's transcript
+		err = updateTranscript(stub, traineeID, func(transcript *Transcript, at time.Time) {
+			for _, vlab := range assigned {
+				transcript.assign(vlab, platform.PlatformID, at)
+			}
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return shim.Success(nil)
+}
+
+// getPathProgress returns a trainee's enrollments in learning paths.
+// Arguments: traineeID
+func (t *SimpleChaincode) getPathProgress(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(pathEnrollmentObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	enrollments := []PathEnrollment{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		enrollment := PathEnrollment{}
+		err = json.Unmarshal(queryResult.Value, &enrollment)
+		if err != nil {
+			return shim.Error("Failed to unmarshal learning path enrollment JSON")
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+
+	enrollmentsJSON, err := json.Marshal(enrollments)
+	if err != nil {
+		return shim.Error("Failed to marshal learning path enrollments to JSON")
+	}
+
+	return shim.Success(enrollmentsJSON)
+}
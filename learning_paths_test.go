@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPathStepNeedsPassingResult(t *testing.T) {
+	stub := newTestPlatform(t)
+	mustInvoke(t, stub, "createLearningPath", "admin1", "p1", "web", "Web", "Web boxes", `[{"VlabID":"v1"},{"VlabID":"v2"}]`)
+	mustInvoke(t, stub, "enrollInLearningPath", "admin1", "t1", "web")
+
+	step := func() int {
+		t.Helper()
+		enrollments := []PathEnrollment{}
+		err := json.Unmarshal(mustInvoke(t, stub, "getPathProgress", "t1"), &enrollments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(enrollments) != 1 {
+			t.Fatalf("%d enrollments, want 1", len(enrollments))
+		}
+		return enrollments[0].CurrentStep
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "1")
+	if current := step(); current != 0 {
+		t.Fatalf("step after 1%% = %d, want 0", current)
+	}
+	trainee := Trainee{}
+	getTestState(t, stub, "t1", &trainee)
+	if _, assigned := trainee.VlabPointsMap2["v2"]; assigned {
+		t.Fatal("v2 assigned after 1% on v1")
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "50")
+	if current := step(); current != 1 {
+		t.Fatalf("step after 50%% = %d, want 1", current)
+	}
+	getTestState(t, stub, "t1", &trainee)
+	if _, assigned := trainee.VlabPointsMap2["v2"]; !assigned {
+		t.Fatal("v2 not assigned after passing v1")
+	}
+}
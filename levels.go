@@ -0,0 +1,226 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The level thresholds are one ledger-wide record under the composite key
+//
+//	levels \x00
+//
+// A trainee's Level is the highest level whose threshold the trainee's
+// experience points reach. It is recomputed whenever the points change.
+const levelsObjectType = "levels"
+
+// Level is one rank tier and the experience points needed to reach it
+type Level struct {
+	Name         string
+	MinExpPoints int
+}
+
+// LevelThresholds is the stored level configuration, lowest level first
+type LevelThresholds struct {
+	DocType string `json:"docType"`
+	Levels  []Level
+}
+
+// defaultLevelThresholds apply until an administrator sets others
+func defaultLevelThresholds() *LevelThresholds {
+	return &LevelThresholds{
+		DocType: levelsObjectType,
+		Levels: []Level{
+			{Name: "Novice", MinExpPoints: 0},
+			{Name: "Apprentice", MinExpPoints: 500},
+			{Name: "Hacker", MinExpPoints: 2000},
+			{Name: "Elite", MinExpPoints: 5000},
+		},
+	}
+}
+
+// validate checks thresholds submitted by an administrator
+func (thresholds *LevelThresholds) validate() error {
+	if len(thresholds.Levels) == 0 {
+		return fmt.Errorf("At least one level is required")
+	}
+	if thresholds.Levels[0].MinExpPoints != 0 {
+		return fmt.Errorf("The first level must start at 0 experience points")
+	}
+
+	names := map[string]bool{}
+	for i, level := range thresholds.Levels {
+		if level.Name == "" {
+			return fmt.Errorf("Level %d has no name", i+1)
+		}
+		if names[level.Name] {
+			return fmt.Errorf("Level %s is listed twice", level.Name)
+		}
+		names[level.Name] = true
+		if i > 0 && level.MinExpPoints <= thresholds.Levels[i-1].MinExpPoints {
+			return fmt.Errorf("Level %s must need more experience points than %s", level.Name, thresholds.Levels[i-1].Name)
+		}
+	}
+	return nil
+}
+
+// levelIndex returns the index of the level reached with the given points
+func (thresholds *LevelThresholds) levelIndex(expPoints int) int {
+	index := 0
+	for i, level := range thresholds.Levels {
+		if expPoints >= level.MinExpPoints {
+			index = i
+		}
+	}
+	return index
+}
+
+// getLevelThresholdsRecord reads the level thresholds, or the defaults if
+// none were set
+func getLevelThresholdsRecord(stub shim.ChaincodeStubInterface) (*LevelThresholds, error) {
+	levelsKey, err := stub.CreateCompositeKey(levelsObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	levelsBytes, err := stub.GetState(levelsKey)
+	if err != nil {
+		return nil, err
+	}
+	if levelsBytes == nil {
+		return defaultLevelThresholds(), nil
+	}
+
+	thresholds := &LevelThresholds{}
+	err = json.Unmarshal(levelsBytes, thresholds)
+	if err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+// setLevel sets a trainee's level from the trainee's experience points
+func setLevel(stub shim.ChaincodeStubInterface, trainee *Trainee) error {
+	thresholds, err := getLevelThresholdsRecord(stub)
+	if err != nil {
+		return err
+	}
+
+	trainee.Level = thresholds.Levels[thresholds.levelIndex(trainee.TotalExpPoints)].Name
+	return nil
+}
+
+// emitLevelUp emits LevelUp if a trainee's points crossed a level threshold
+// upwards
+func emitLevelUp(stub shim.ChaincodeStubInterface, previous *Trainee, current *Trainee) error {
+	if current.TotalExpPoints <= previous.TotalExpPoints {
+		return nil
+	}
+
+	thresholds, err := getLevelThresholdsRecord(stub)
+	if err != nil {
+		return err
+	}
+	if thresholds.levelIndex(current.TotalExpPoints) <= thresholds.levelIndex(previous.TotalExpPoints) {
+		return nil
+	}
+
+	return emitEvent(stub, LevelUpEventType, LevelUpEvent{
+		TraineeID:      current.TraineeID,
+		PlatformID:     current.ActivePlatform,
+		PreviousLevel:  previous.Level,
+		Level:          current.Level,
+		TotalExpPoints: current.TotalExpPoints,
+	})
+}
+
+// setLevelThresholds replaces the level thresholds. Trainees keep their level
+// until their points change or calculateExpPoints recomputes their platform.
+// Arguments: administratorID, thresholds JSON
+// e.g. {"Levels":[{"Name":"Novice","MinExpPoints":0},{"Name":"Elite","MinExpPoints":5000}]}
+func (t *SimpleChaincode) setLevelThresholds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID and thresholds")
+	}
+
+	administratorID := args[0]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	thresholds := &LevelThresholds{}
+	err := json.Unmarshal([]byte(args[1]), thresholds)
+	if err != nil {
+		return shim.Error("Failed to unmarshal level thresholds JSON")
+	}
+	thresholds.DocType = levelsObjectType
+	err = thresholds.validate()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	thresholdsJSON, err := json.Marshal(thresholds)
+	if err != nil {
+		return shim.Error("Failed to marshal level thresholds to JSON")
+	}
+
+	levelsKey, err := stub.CreateCompositeKey(levelsObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(levelsKey, thresholdsJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, LevelThresholdsSetEventType, LevelThresholdsSetEvent{
+		AdministratorID: administratorID,
+		Levels:          thresholds.Levels,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getLevelThresholds returns the level thresholds in force.
+// Arguments: none
+func (t *SimpleChaincode) getLevelThresholds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting none")
+	}
+
+	thresholds, err := getLevelThresholdsRecord(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	thresholdsJSON, err := json.Marshal(thresholds)
+	if err != nil {
+		return shim.Error("Failed to marshal level thresholds to JSON")
+	}
+
+	return shim.Success(thresholdsJSON)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testStub is a MockStub whose transactions run on a clock the test
+// controls. Every transaction starts a minute after the previous one.
+type testStub struct {
+	*shimtest.MockStub
+	function string
+	args     []string
+	now      time.Time
+}
+
+// testTxCount numbers the mocked transactions
+var testTxCount int
+
+// newTestStub returns an empty ledger whose clock starts at the beginning of 2026
+func newTestStub() *testStub {
+	return &testStub{
+		MockStub: shimtest.NewMockStub("ledger", new(SimpleChaincode)),
+		now:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// GetFunctionAndParameters returns the function being invoked
+func (stub *testStub) GetFunctionAndParameters() (string, []string) {
+	return stub.function, stub.args
+}
+
+// GetTxTimestamp returns the time on the test clock
+func (stub *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: stub.now.Unix(), Nanos: int32(stub.now.Nanosecond())}, nil
+}
+
+// startTransaction advances the clock and starts a mocked transaction
+func (stub *testStub) startTransaction() {
+	testTxCount++
+	stub.now = stub.now.Add(time.Minute)
+	stub.MockTransactionStart(fmt.Sprintf("tx%04d", testTxCount))
+}
+
+// invoke runs a chaincode function in a transaction of its own
+func invoke(stub *testStub, function string, args ...string) pb.Response {
+	stub.startTransaction()
+	defer stub.MockTransactionEnd("")
+	stub.function, stub.args = function, args
+	response := new(SimpleChaincode).Invoke(stub)
+
+	// The mock queues chaincode events on a bounded channel
+	for len(stub.ChaincodeEventsChannel) > 0 {
+		<-stub.ChaincodeEventsChannel
+	}
+	return response
+}
+
+// mustInvoke runs a chaincode function and fails the test unless it succeeds
+func mustInvoke(t *testing.T, stub *testStub, function string, args ...string) []byte {
+	t.Helper()
+	response := invoke(stub, function, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s %v: %s", function, args, response.Message)
+	}
+	return response.Payload
+}
+
+// putTestState writes a value as it was stored by an earlier chaincode version
+func putTestState(t *testing.T, stub *testStub, key string, value interface{}) {
+	t.Helper()
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.startTransaction()
+	defer stub.MockTransactionEnd("")
+	err = stub.PutState(key, valueJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getTestState reads a stored value into value
+func getTestState(t *testing.T, stub *testStub, key string, value interface{}) {
+	t.Helper()
+	valueBytes, err := stub.GetState(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valueBytes == nil {
+		t.Fatalf("%s does not exist", key)
+	}
+	err = json.Unmarshal(valueBytes, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestPlatform returns a ledger with platform p1 offering vlabs v1 (100
+// points, Easy) and v2 (200 points, Hard), and trainees t1, t2 and t3 on p1
+// who were assigned v1
+func newTestPlatform(t *testing.T) *testStub {
+	stub := newTestStub()
+
+	mustInvoke(t, stub, "createAdministrator", "admin1", "Ada", "Admin", "admin1@example.com", "Athens", "admin", "ada")
+	mustInvoke(t, stub, "createVlabOwner", "vlabowner1", "Olga", "Owner", "owner1@example.com", "Athens", "owner", "olga")
+	mustInvoke(t, stub, "createTrainer", "Trainer1", "Tom", "Trainer", "trainer1@example.com", "Athens", "trainer", "tom")
+	mustInvoke(t, stub, "createPlatform", "p1", "Platform 1", "p1@example.com", "first platform")
+	mustInvoke(t, stub, "createVlab", "vlabowner1", "v1", "Box 1", "Web", "Linux", "first box", "100", "Easy", "60")
+	mustInvoke(t, stub, "createVlab", "vlabowner1", "v2", "Box 2", "Web", "Linux", "second box", "200", "Hard", "120")
+	mustInvoke(t, stub, "addVlabToPlatform", "admin1", "v1", "p1")
+	mustInvoke(t, stub, "addVlabToPlatform", "admin1", "v2", "p1")
+	for _, traineeID := range []string{"t1", "t2", "t3"} {
+		mustInvoke(t, stub, "createTrainee", traineeID, "First", "Last", traineeID+"@example.com", "Athens", "trainee", "nick-"+traineeID)
+		mustInvoke(t, stub, "addTraineeToPlatform", "admin1", traineeID, "p1")
+		mustInvoke(t, stub, "addVlabToTrainee", traineeID, "v1")
+	}
+	return stub
+}
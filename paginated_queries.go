@@ -0,0 +1,369 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Object types used as the prefix of the per-type index keys. Every entity is
+// still stored under its plain ID; the index entry "<objectType>\x00<ID>\x00"
+// only exists so that one type can be listed without scanning the world state.
+const (
+	traineeObjectType       = "trainee"
+	platformObjectType      = "platform"
+	vlabObjectType          = "vlab"
+	trainerObjectType       = "trainer"
+	administratorObjectType = "administrator"
+	vlabOwnerObjectType     = "vlabowner"
+)
+
+var indexedObjectTypes = []string{
+	traineeObjectType,
+	platformObjectType,
+	vlabObjectType,
+	trainerObjectType,
+	administratorObjectType,
+	vlabOwnerObjectType,
+}
+
+// PaginatedQueryResult is returned by the typed list functions
+type PaginatedQueryResult struct {
+	PageSize            int32
+	FetchedRecordsCount int32
+	Bookmark            string
+	Records             []interface{}
+}
+
+// newObject returns a pointer to an empty entity of the given object type
+func newObject(objectType string) (interface{}, error) {
+	switch objectType {
+	case traineeObjectType:
+		return &Trainee{}, nil
+	case platformObjectType:
+		return &Platform{}, nil
+	case vlabObjectType:
+		return &Vlab{}, nil
+	case trainerObjectType:
+		return &Trainer{}, nil
+	case administratorObjectType:
+		return &Administrator{}, nil
+	case vlabOwnerObjectType:
+		return &VlabOwner{}, nil
+	}
+	return nil, fmt.Errorf("Unknown entity type %s", objectType)
+}
+
+// objectTypeOf guesses the object type of a stored entity from its ID field
+func objectTypeOf(value []byte) string {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return ""
+	}
+
+	if _, ok := fields["TraineeID"]; ok {
+		return traineeObjectType
+	} else if _, ok := fields["PlatformID"]; ok {
+		return platformObjectType
+	} else if _, ok := fields["vlabID"]; ok {
+		return vlabObjectType
+	} else if _, ok := fields["TrainerID"]; ok {
+		return trainerObjectType
+	} else if _, ok := fields["AdministratorID"]; ok {
+		return administratorObjectType
+	} else if _, ok := fields["VLabOwnerID"]; ok {
+		return vlabOwnerObjectType
+	}
+	return ""
+}
+
+// putObjectIndex records the ID in the index of its object type
+func putObjectIndex(stub shim.ChaincodeStubInterface, objectType string, id string) error {
+	indexKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+
+	// Only the key is needed, the value is a placeholder as in the marbles sample
+	return stub.PutState(indexKey, []byte{0x00})
+}
+
+// delObjectIndex removes the ID from the index of every object type
+func delObjectIndex(stub shim.ChaincodeStubInterface, id string) error {
+	for _, objectType := range indexedObjectTypes {
+		indexKey, err := stub.CreateCompositeKey(objectType, []string{id})
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(indexKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePagination reads the pageSize and bookmark arguments of a list query
+func parsePagination(args []string) (int32, string, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return 0, "", fmt.Errorf("Incorrect number of arguments. Expecting pageSize and optional bookmark")
+	}
+
+	pageSize, err := strconv.ParseInt(args[0], 10, 32)
+	if err != nil || pageSize <= 0 {
+		return 0, "", fmt.Errorf("pageSize must be a positive integer")
+	}
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+
+	return int32(pageSize), bookmark, nil
+}
+
+// listObjects returns one page of the entities of the given object type
+func listObjects(stub shim.ChaincodeStubInterface, objectType string, args []string) pb.Response {
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Walk the index keys of the object type
+	resultsIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(objectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []interface{}{}
+	for resultsIterator.HasNext() {
+		indexEntry, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(indexEntry.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		id := attributes[0]
+
+		// Retrieve the entity the index entry points to
+		objectBytes, err := stub.GetState(id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if objectBytes == nil {
+			continue
+		}
+
+		record, err := newObject(objectType)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = json.Unmarshal(objectBytes, record)
+		if err != nil {
+			return shim.Error("Failed to unmarshal " + objectType + " " + id + " JSON")
+		}
+		records = append(records, record)
+	}
+
+	result := PaginatedQueryResult{
+		PageSize:            pageSize,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+		Records:             records,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to marshal query result to JSON")
+	}
+
+	return shim.Success(resultJSON)
+}
+
+func (t *SimpleChaincode) listTrainees(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, traineeObjectType, args)
+}
+
+func (t *SimpleChaincode) listPlatforms(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, platformObjectType, args)
+}
+
+func (t *SimpleChaincode) listVlabs(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, vlabObjectType, args)
+}
+
+func (t *SimpleChaincode) listTrainers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, trainerObjectType, args)
+}
+
+func (t *SimpleChaincode) listAdministrators(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, administratorObjectType, args)
+}
+
+func (t *SimpleChaincode) listVlabOwners(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return listObjects(stub, vlabOwnerObjectType, args)
+}
+
+// reindexAssets builds the type indexes, the rich query fields and the
+// leaderboard entries for entities written before they existed. Paginated range queries are not
+// allowed in an invoke, so it walks at most limit keys starting at startKey
+// and returns the key to continue from, or an empty string when the world
+// state is exhausted.
+func (t *SimpleChaincode) reindexAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, startKey and limit")
+	}
+
+	administratorID := args[0]
+	startKey := args[1]
+	limit, err := strconv.Atoi(args[2])
+	if err != nil || limit <= 0 {
+		return shim.Error("limit must be a positive integer")
+	}
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	resultsIterator, err := stub.GetStateByRange(startKey, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	nextKey := ""
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if count == limit {
+			nextKey = queryResult.Key
+			break
+		}
+		count++
+
+		objectType := objectTypeOf(queryResult.Value)
+		if objectType == "" {
+			continue
+		}
+		err = putObjectIndex(stub, objectType, queryResult.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// Fill in the fields the rich queries select on
+		updatedJSON, err := backfillQueryFields(objectType, queryResult.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// Award results recorded before awarded points existed
+		switch objectType {
+		case traineeObjectType:
+			updatedJSON, err = reindexTrainee(stub, queryResult.Value, updatedJSON)
+		case platformObjectType:
+			updatedJSON, err = reindexPlatform(stub, updatedJSON)
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		err = stub.PutState(queryResult.Key, updatedJSON)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	err = emitEvent(stub, AssetsReindexedEventType, AssetsReindexedEvent{
+		AdministratorID: administratorID,
+		StartKey:        startKey,
+		NextKey:         nextKey,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(nextKey))
+}
+
+// reindexTrainee recomputes the experience points of a trainee, stored as
+// stored and backfilled as value, which awards the points of legacy results,
+// and writes the trainee's leaderboard entry
+func reindexTrainee(stub shim.ChaincodeStubInterface, stored []byte, value []byte) ([]byte, error) {
+	previous := Trainee{}
+	err := json.Unmarshal(stored, &previous)
+	if err != nil {
+		return nil, err
+	}
+	trainee := Trainee{}
+	err = json.Unmarshal(value, &trainee)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recalculateExpPoints(stub, &trainee)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trainees written before the leaderboard existed have no entry yet
+	err = updateLeaderboard(stub, &previous, &trainee)
+	if err != nil {
+		return nil, err
+	}
+
+	if trainee.TotalExpPoints != previous.TotalExpPoints {
+		err = emitExpPointsChange(stub, &previous, &trainee)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(trainee)
+}
+
+// reindexPlatform recomputes the experience points of a platform's trainee
+// copies the way reindexTrainee does for the trainees
+func reindexPlatform(stub shim.ChaincodeStubInterface, value []byte) ([]byte, error) {
+	platform := Platform{}
+	err := json.Unmarshal(value, &platform)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range platform.Trainees {
+		err = recalculateExpPoints(stub, &platform.Trainees[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(platform)
+}
@@ -0,0 +1,243 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// VlabStats holds the figures of one vlab of a platform. The completion rate
+// is the share of the trainees holding the vlab that have a result for it.
+type VlabStats struct {
+	VlabID         string
+	BoxName        string
+	Domain         string
+	BoxDifficulty  string
+	AssignedCount  int
+	CompletedCount int
+	CompletionRate float64
+	AverageScore   float64
+	MedianScore    float64
+}
+
+// GroupStats holds the figures of the vlabs sharing a domain or a difficulty
+type GroupStats struct {
+	Name           string
+	VlabCount      int
+	AssignedCount  int
+	CompletedCount int
+	CompletionRate float64
+	AverageScore   float64
+}
+
+// PlatformStats is the report returned by getPlatformStats
+type PlatformStats struct {
+	PlatformID      string
+	TraineeCount    int
+	VlabCount       int
+	TotalExpAwarded int
+	Vlabs           []VlabStats
+	Domains         []GroupStats
+	Difficulties    []GroupStats
+}
+
+// parseScore returns the numeric value of a vlab result, if it has one. A
+// pass counts as 100 and a fail as 0.
+func parseScore(result string) (float64, bool) {
+	switch strings.ToLower(result) {
+	case "":
+		return 0, false
+	case "pass":
+		return 100, true
+	case "fail":
+		return 0, true
+	}
+	score, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		return 0, false
+	}
+	return score, true
+}
+
+// average returns the mean of the scores, or 0 for none
+func average(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, score := range scores {
+		sum += score
+	}
+	return sum / float64(len(scores))
+}
+
+// median returns the median of the scores, or 0 for none
+func median(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, scores...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// rate returns part/whole, or 0 when whole is 0
+func rate(part int, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// groupAccumulator collects the figures of one domain or difficulty
+type groupAccumulator struct {
+	vlabCount      int
+	assignedCount  int
+	completedCount int
+	scores         []float64
+}
+
+// addToGroup adds the figures of a vlab to the named group
+func addToGroup(groups map[string]*groupAccumulator, name string, vlabStats VlabStats, scores []float64) {
+	group, exists := groups[name]
+	if !exists {
+		group = &groupAccumulator{}
+		groups[name] = group
+	}
+	group.vlabCount++
+	group.assignedCount += vlabStats.AssignedCount
+	group.completedCount += vlabStats.CompletedCount
+	group.scores = append(group.scores, scores...)
+}
+
+// groupStats turns the accumulators into a list sorted by name
+func groupStats(groups map[string]*groupAccumulator) []GroupStats {
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := []GroupStats{}
+	for _, name := range names {
+		group := groups[name]
+		stats = append(stats, GroupStats{
+			Name:           name,
+			VlabCount:      group.vlabCount,
+			AssignedCount:  group.assignedCount,
+			CompletedCount: group.completedCount,
+			CompletionRate: rate(group.completedCount, group.assignedCount),
+			AverageScore:   average(group.scores),
+		})
+	}
+	return stats
+}
+
+// getPlatformStats returns the aggregate figures of a platform. It is computed
+// from the platform record alone, which carries the catalogue in Vlabs and a
+// copy of every registered trainee with their results.
+// Arguments: platformID
+func (t *SimpleChaincode) getPlatformStats(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	platformID := args[0]
+
+	// Retrieve the platform from the ledger
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("PlatformID does not exist")
+	}
+
+	// Unmarshal platform JSON
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error("Failed to unmarshal platform JSON")
+	}
+
+	stats := PlatformStats{
+		PlatformID:   platformID,
+		TraineeCount: len(platform.Trainees),
+		VlabCount:    len(platform.Vlabs),
+		Vlabs:        []VlabStats{},
+	}
+
+	for _, trainee := range platform.Trainees {
+		stats.TotalExpAwarded += trainee.TotalExpPoints
+	}
+
+	domains := map[string]*groupAccumulator{}
+	difficulties := map[string]*groupAccumulator{}
+
+	for _, vlab := range platform.Vlabs {
+		vlabStats := VlabStats{
+			VlabID:        vlab.VlabID,
+			BoxName:       vlab.BoxName,
+			Domain:        vlab.Domain,
+			BoxDifficulty: vlab.BoxDifficulty,
+		}
+
+		// Collect the results of the trainees holding the vlab
+		scores := []float64{}
+		for _, trainee := range platform.Trainees {
+			assigned, exists := trainee.VlabPointsMap2[vlab.VlabID]
+			if !exists {
+				continue
+			}
+			vlabStats.AssignedCount++
+			if assigned.Result != "" {
+				vlabStats.CompletedCount++
+			}
+			if score, ok := parseScore(assigned.Result); ok {
+				scores = append(scores, score)
+			}
+		}
+		vlabStats.CompletionRate = rate(vlabStats.CompletedCount, vlabStats.AssignedCount)
+		vlabStats.AverageScore = average(scores)
+		vlabStats.MedianScore = median(scores)
+		stats.Vlabs = append(stats.Vlabs, vlabStats)
+
+		// Add the vlab to its domain and difficulty breakdowns
+		addToGroup(domains, vlab.Domain, vlabStats, scores)
+		addToGroup(difficulties, vlab.BoxDifficulty, vlabStats, scores)
+	}
+
+	stats.Domains = groupStats(domains)
+	stats.Difficulties = groupStats(difficulties)
+
+	statsJSON, err := json.Marshal(stats)
+	if err != nil {
+		return shim.Error("Failed to marshal platform stats to JSON")
+	}
+
+	return shim.Success(statsJSON)
+}
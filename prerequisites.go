@@ -0,0 +1,258 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Prerequisites are kept on the vlab records and form a directed acyclic
+// graph: setVlabPrerequisites refuses any edge that would close a cycle.
+
+// PrerequisiteNode is one vlab of a prerequisite tree
+type PrerequisiteNode struct {
+	VlabID        string
+	BoxName       string
+	Prerequisites []PrerequisiteNode
+}
+
+// getVlabRecord reads a vlab from the ledger
+func getVlabRecord(stub shim.ChaincodeStubInterface, vlabID string) (*Vlab, error) {
+	vlabBytes, err := stub.GetState(vlabID)
+	if err != nil {
+		return nil, err
+	}
+	if vlabBytes == nil {
+		return nil, fmt.Errorf("Vlab %s does not exist", vlabID)
+	}
+
+	vlab := &Vlab{}
+	err = json.Unmarshal(vlabBytes, vlab)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal vlab %s JSON", vlabID)
+	}
+
+	// The key may hold another entity. Vlabs written before docType existed
+	// are told apart by their vlabID.
+	if vlab.DocType != vlabObjectType && (vlab.DocType != "" || vlab.VlabID != vlabID) {
+		return nil, fmt.Errorf("%s is not a vlab", vlabID)
+	}
+	return vlab, nil
+}
+
+// requires reports whether target is reachable from vlabID over prerequisite
+// edges. visited holds the vlabs already searched.
+func requires(stub shim.ChaincodeStubInterface, vlabID string, target string, visited map[string]bool) (bool, error) {
+	if vlabID == target {
+		return true, nil
+	}
+	if visited[vlabID] {
+		return false, nil
+	}
+	visited[vlabID] = true
+
+	vlab, err := getVlabRecord(stub, vlabID)
+	if err != nil {
+		return false, err
+	}
+	for _, prerequisiteID := range vlab.Prerequisites {
+		found, err := requires(stub, prerequisiteID, target, visited)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// passedVlab reports whether a trainee has a passing result for a vlab,
+// either on the current platform or, for vlabs dropped since, in the
+// trainee's transcript. Results pass by the rules of the platform they were
+// recorded on.
+func passedVlab(stub shim.ChaincodeStubInterface, trainee *Trainee, vlabID string) (bool, error) {
+	if vlab, exists := trainee.VlabPointsMap2[vlabID]; exists && vlab.Result != "" {
+		rules, err := getScoringRulesRecord(stub, trainee.ActivePlatform)
+		if err != nil {
+			return false, err
+		}
+		if rules.passes(vlab) {
+			return true, nil
+		}
+	}
+
+	transcript, err := getTranscriptRecord(stub, trainee.TraineeID)
+	if err != nil {
+		return false, err
+	}
+	var rubric *Rubric
+	if record, err := getVlabRecord(stub, vlabID); err == nil {
+		// A deleted vlab no longer has a rubric to pass by
+		rubric = record.Rubric
+	}
+	for i := range transcript.Vlabs {
+		attempt := &transcript.Vlabs[i]
+		if attempt.VlabID != vlabID {
+			continue
+		}
+		grade, graded := attempt.lastGrade()
+		if !graded || grade.Result == "" {
+			continue
+		}
+		rules, err := getScoringRulesRecord(stub, attempt.PlatformID)
+		if err != nil {
+			return false, err
+		}
+		if rules.passes(Vlab{VlabID: vlabID, Result: grade.Result, Rubric: rubric}) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// missingPrerequisites returns the prerequisites of a vlab the trainee has
+// not passed yet
+func missingPrerequisites(stub shim.ChaincodeStubInterface, trainee *Trainee, vlab *Vlab) ([]string, error) {
+	missing := []string{}
+	for _, prerequisiteID := range vlab.Prerequisites {
+		passed, err := passedVlab(stub, trainee, prerequisiteID)
+		if err != nil {
+			return nil, err
+		}
+		if !passed {
+			missing = append(missing, prerequisiteID)
+		}
+	}
+	return missing, nil
+}
+
+// setVlabPrerequisites replaces the prerequisites of a vlab.
+// Arguments: vlabOwnerID or administratorID, vlabID, prerequisite vlab IDs as a JSON array
+func (t *SimpleChaincode) setVlabPrerequisites(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting vlabOwnerID or administratorID, vlabID and prerequisites")
+	}
+
+	callerID := args[0]
+	vlabID := args[1]
+
+	// Check if callerID starts with "vlabowner" or "admin"
+	if !strings.HasPrefix(callerID, "vlabowner") && !strings.HasPrefix(callerID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	prerequisites := []string{}
+	err := json.Unmarshal([]byte(args[2]), &prerequisites)
+	if err != nil {
+		return shim.Error("Failed to unmarshal prerequisites JSON array")
+	}
+
+	vlab, err := getVlabRecord(stub, vlabID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Every prerequisite must exist and must not lead back to the vlab
+	seen := map[string]bool{}
+	for _, prerequisiteID := range prerequisites {
+		if seen[prerequisiteID] {
+			return shim.Error("Prerequisite " + prerequisiteID + " is listed twice")
+		}
+		seen[prerequisiteID] = true
+
+		if prerequisiteID == vlabID {
+			return shim.Error("A vlab cannot be its own prerequisite")
+		}
+		cycle, err := requires(stub, prerequisiteID, vlabID, map[string]bool{})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if cycle {
+			return shim.Error("Prerequisite " + prerequisiteID + " already requires " + vlabID + ", which would create a cycle")
+		}
+	}
+
+	vlab.Prerequisites = prerequisites
+
+	vlabJSON, err := json.Marshal(vlab)
+	if err != nil {
+		return shim.Error("Failed to marshal vlab to JSON")
+	}
+	err = stub.PutState(vlabID, vlabJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabPrerequisitesSetEventType, VlabPrerequisitesSetEvent{
+		CallerID:      callerID,
+		VlabID:        vlabID,
+		Prerequisites: prerequisites,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// prerequisiteTree builds the tree of a vlab's prerequisites. Since the
+// graph has no cycles, the recursion ends; a prerequisite shared by several
+// vlabs appears under each of them.
+func prerequisiteTree(stub shim.ChaincodeStubInterface, vlabID string) (PrerequisiteNode, error) {
+	vlab, err := getVlabRecord(stub, vlabID)
+	if err != nil {
+		return PrerequisiteNode{}, err
+	}
+
+	node := PrerequisiteNode{
+		VlabID:        vlab.VlabID,
+		BoxName:       vlab.BoxName,
+		Prerequisites: []PrerequisiteNode{},
+	}
+	for _, prerequisiteID := range vlab.Prerequisites {
+		child, err := prerequisiteTree(stub, prerequisiteID)
+		if err != nil {
+			return PrerequisiteNode{}, err
+		}
+		node.Prerequisites = append(node.Prerequisites, child)
+	}
+	return node, nil
+}
+
+// getPrerequisiteTree returns a vlab with its prerequisites, their
+// prerequisites and so on.
+// Arguments: vlabID
+func (t *SimpleChaincode) getPrerequisiteTree(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting vlabID")
+	}
+
+	tree, err := prerequisiteTree(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	treeJSON, err := json.Marshal(tree)
+	if err != nil {
+		return shim.Error("Failed to marshal prerequisite tree to JSON")
+	}
+
+	return shim.Success(treeJSON)
+}
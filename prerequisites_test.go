@@ -0,0 +1,38 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestPrerequisiteNeedsPassingResult(t *testing.T) {
+	stub := newTestPlatform(t)
+	mustInvoke(t, stub, "setVlabPrerequisites", "vlabowner1", "v2", `["v1"]`)
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "1")
+	response := invoke(stub, "addVlabToTrainee", "t1", "v2")
+	if response.Status == shim.OK || !strings.Contains(response.Message, "prerequisites v1") {
+		t.Fatalf("assigning v2 after 1%% on v1: status %d %q, want missing prerequisite v1", response.Status, response.Message)
+	}
+
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "50")
+	mustInvoke(t, stub, "addVlabToTrainee", "t1", "v2")
+}
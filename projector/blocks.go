@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// blockEvents extracts the chaincode events of the valid endorser
+// transactions in a block. Events of other chaincodes are skipped unless
+// chaincodeName is empty.
+func blockEvents(block *common.Block, chaincodeName string) ([]ChaincodeEventRecord, error) {
+	if block.Header == nil || block.Data == nil {
+		return nil, fmt.Errorf("malformed block")
+	}
+
+	// The peer marks invalid transactions in the transactions filter
+	var validationCodes []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validationCodes = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	records := []ChaincodeEventRecord{}
+	for i, envelopeBytes := range block.Data.Data {
+		if i < len(validationCodes) && peer.TxValidationCode(validationCodes[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+			return nil, fmt.Errorf("block %d tx %d: %w", block.Header.Number, i, err)
+		}
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+			return nil, fmt.Errorf("block %d tx %d: %w", block.Header.Number, i, err)
+		}
+		if payload.Header == nil {
+			continue
+		}
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+			return nil, fmt.Errorf("block %d tx %d: %w", block.Header.Number, i, err)
+		}
+		if channelHeader.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+			continue
+		}
+
+		transaction := &peer.Transaction{}
+		if err := proto.Unmarshal(payload.Data, transaction); err != nil {
+			return nil, fmt.Errorf("block %d tx %s: %w", block.Header.Number, channelHeader.TxId, err)
+		}
+
+		for _, action := range transaction.Actions {
+			event, err := actionEvent(action)
+			if err != nil {
+				return nil, fmt.Errorf("block %d tx %s: %w", block.Header.Number, channelHeader.TxId, err)
+			}
+			if event == nil || event.EventName == "" {
+				continue
+			}
+			if chaincodeName != "" && event.ChaincodeId != chaincodeName {
+				continue
+			}
+
+			records = append(records, ChaincodeEventRecord{
+				BlockNumber:   block.Header.Number,
+				TxID:          channelHeader.TxId,
+				ChaincodeName: event.ChaincodeId,
+				EventName:     event.EventName,
+				Payload:       event.Payload,
+			})
+		}
+	}
+
+	return records, nil
+}
+
+// actionEvent unwraps the chaincode event of a transaction action
+func actionEvent(action *peer.TransactionAction) (*peer.ChaincodeEvent, error) {
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(action.Payload, actionPayload); err != nil {
+		return nil, err
+	}
+	if actionPayload.Action == nil {
+		return nil, nil
+	}
+
+	responsePayload := &peer.ProposalResponsePayload{}
+	if err := proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload); err != nil {
+		return nil, err
+	}
+
+	chaincodeAction := &peer.ChaincodeAction{}
+	if err := proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+		return nil, err
+	}
+	if len(chaincodeAction.Events) == 0 {
+		return nil, nil
+	}
+
+	event := &peer.ChaincodeEvent{}
+	if err := proto.Unmarshal(chaincodeAction.Events, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
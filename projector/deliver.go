@@ -0,0 +1,219 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DeliverSource streams blocks from a peer's Deliver service. The seek
+// request is signed with the client's X.509 identity, which must be allowed
+// to read blocks on the channel.
+type DeliverSource struct {
+	Address       string
+	ServerName    string
+	TLSCACertPath string
+	MSPID         string
+	CertPath      string
+	KeyPath       string
+	ChannelID     string
+	ChaincodeName string
+}
+
+// Run implements Source. It only returns on error or when ctx is done.
+func (s *DeliverSource) Run(ctx context.Context, fromBlock uint64, handler Handler) error {
+	signer, err := newSigner(s.MSPID, s.CertPath, s.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	caPEM, err := os.ReadFile(s.TLSCACertPath)
+	if err != nil {
+		return err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates in %s", s.TLSCACertPath)
+	}
+	transportCredentials := credentials.NewTLS(&tls.Config{
+		RootCAs:    certPool,
+		ServerName: s.ServerName,
+	})
+
+	connection, err := grpc.DialContext(ctx, s.Address, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	stream, err := peer.NewDeliverClient(connection).Deliver(ctx)
+	if err != nil {
+		return err
+	}
+
+	seekEnvelope, err := signer.seekEnvelope(s.ChannelID, fromBlock)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(seekEnvelope); err != nil {
+		return err
+	}
+
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch content := response.Type.(type) {
+		case *peer.DeliverResponse_Block:
+			if err := handleBlock(content.Block, s.ChaincodeName, handler); err != nil {
+				return err
+			}
+		case *peer.DeliverResponse_Status:
+			return fmt.Errorf("deliver stream ended with status %s", content.Status)
+		}
+	}
+}
+
+// signer signs requests with an ECDSA identity issued by a Fabric CA
+type signer struct {
+	mspID       string
+	certificate []byte
+	privateKey  *ecdsa.PrivateKey
+}
+
+func newSigner(mspID string, certPath string, keyPath string) (*signer, error) {
+	certificate, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ECDSA key", keyPath)
+	}
+
+	return &signer{mspID: mspID, certificate: certificate, privateKey: privateKey}, nil
+}
+
+// sign returns a low-S ECDSA signature of the SHA-256 digest, the only form
+// Fabric accepts
+func (s *signer) sign(message []byte) ([]byte, error) {
+	digest := sha256.Sum256(message)
+	r, sig, err := ecdsa.Sign(rand.Reader, s.privateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	curveOrder := s.privateKey.Params().N
+	halfOrder := new(big.Int).Rsh(curveOrder, 1)
+	if sig.Cmp(halfOrder) > 0 {
+		sig = new(big.Int).Sub(curveOrder, sig)
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+}
+
+// seekEnvelope builds the signed request for every block from fromBlock on
+func (s *signer) seekEnvelope(channelID string, fromBlock uint64) (*common.Envelope, error) {
+	seekInfo := &orderer.SeekInfo{
+		Start: &orderer.SeekPosition{
+			Type: &orderer.SeekPosition_Specified{Specified: &orderer.SeekSpecified{Number: fromBlock}},
+		},
+		Stop: &orderer.SeekPosition{
+			Type: &orderer.SeekPosition_Specified{Specified: &orderer.SeekSpecified{Number: math.MaxUint64}},
+		},
+		Behavior: orderer.SeekInfo_BLOCK_UNTIL_READY,
+	}
+	seekInfoBytes, err := proto.Marshal(seekInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	channelHeaderBytes, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_DELIVER_SEEK_INFO),
+		ChannelId: channelID,
+		Timestamp: ptypes.TimestampNow(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: s.mspID, IdBytes: s.certificate})
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	signatureHeaderBytes, err := proto.Marshal(&common.SignatureHeader{Creator: creator, Nonce: nonce})
+	if err != nil {
+		return nil, err
+	}
+
+	payloadBytes, err := proto.Marshal(&common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   channelHeaderBytes,
+			SignatureHeader: signatureHeaderBytes,
+		},
+		Data: seekInfoBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.sign(payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.Envelope{Payload: payloadBytes, Signature: signature}, nil
+}
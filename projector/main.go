@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command projector consumes the chaincode's events and projects trainees,
+// platforms and vlabs into a local SQLite read model for dashboards and
+// analytics.
+//
+// Events come from one of three sources:
+//
+//	-events file.jsonl   a recorded event file (see -record)
+//	-blocks dir          a directory of block files from "peer channel fetch"
+//	-peer host:port      the live Deliver service of a peer
+//
+// The projector resumes from its checkpoint unless -from-block is given.
+// -reset empties the read model first so it can be rebuilt by replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// projection applies events to the store and optionally records them
+type projection struct {
+	store    *Store
+	recorder *json.Encoder
+}
+
+// Event implements Handler
+func (p *projection) Event(record ChaincodeEventRecord) error {
+	if p.recorder != nil {
+		if err := p.recorder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	applied, err := p.store.Apply(record)
+	if err != nil {
+		return err
+	}
+	if applied {
+		log.Printf("block %d tx %s: applied %s", record.BlockNumber, record.TxID, record.EventName)
+	}
+	return nil
+}
+
+// BlockDone implements Handler
+func (p *projection) BlockDone(blockNumber uint64) error {
+	return p.store.BlockDone(blockNumber)
+}
+
+func main() {
+	dbPath := flag.String("db", "projector.db", "SQLite read model file")
+	eventsPath := flag.String("events", "", "replay a recorded event file")
+	blocksDir := flag.String("blocks", "", "replay a directory of *.block files")
+	peerAddress := flag.String("peer", "", "peer address for live block delivery")
+	serverName := flag.String("server-name", "", "TLS server name override of the peer")
+	tlsCACert := flag.String("tls-ca", "", "TLS CA certificate of the peer")
+	mspID := flag.String("msp-id", "", "MSP ID of the client identity")
+	certPath := flag.String("cert", "", "client identity certificate")
+	keyPath := flag.String("key", "", "client identity private key (PKCS#8)")
+	channelID := flag.String("channel", "mychannel", "channel name")
+	chaincodeName := flag.String("chaincode", "", "only project events of this chaincode")
+	fromBlock := flag.Int64("from-block", -1, "block to start from, -1 resumes from the checkpoint")
+	reset := flag.Bool("reset", false, "empty the read model before projecting")
+	recordPath := flag.String("record", "", "append every consumed event to this file")
+	flag.Parse()
+
+	var source Source
+	switch {
+	case *eventsPath != "":
+		source = &EventFileSource{Path: *eventsPath, ChaincodeName: *chaincodeName}
+	case *blocksDir != "":
+		source = &BlockFileSource{Dir: *blocksDir, ChaincodeName: *chaincodeName}
+	case *peerAddress != "":
+		source = &DeliverSource{
+			Address:       *peerAddress,
+			ServerName:    *serverName,
+			TLSCACertPath: *tlsCACert,
+			MSPID:         *mspID,
+			CertPath:      *certPath,
+			KeyPath:       *keyPath,
+			ChannelID:     *channelID,
+			ChaincodeName: *chaincodeName,
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "one of -events, -blocks or -peer is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(source, *dbPath, *fromBlock, *reset, *recordPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(source Source, dbPath string, fromBlock int64, reset bool, recordPath string) error {
+	store, err := OpenStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	start := uint64(0)
+	if fromBlock >= 0 {
+		start = uint64(fromBlock)
+	}
+	if reset {
+		if err := store.Reset(start); err != nil {
+			return err
+		}
+	}
+	if fromBlock < 0 {
+		start, err = store.NextBlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	handler := &projection{store: store}
+	if recordPath != "" {
+		recordFile, err := os.OpenFile(recordPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer recordFile.Close()
+		handler.recorder = json.NewEncoder(recordFile)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("projecting into %s from block %d", dbPath, start)
+	err = source.Run(ctx, start, handler)
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
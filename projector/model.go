@@ -0,0 +1,138 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The chaincode is a main package and cannot be imported, so the parts of its
+// event schema (events.go in the chaincode) the projector reads are mirrored
+// here. Fields the read model does not use are left out.
+
+// supportedSchemaVersion is the newest chaincode EventSchemaVersion the
+// projector understands. Event types and fields added within a version are
+// skipped until the projector reads them.
+const supportedSchemaVersion = 1
+
+// ChaincodeEventRecord is one chaincode event together with where it was
+// committed. Recorded event files hold one record per line as JSON.
+type ChaincodeEventRecord struct {
+	BlockNumber   uint64
+	TxID          string
+	ChaincodeName string
+	EventName     string
+	Payload       json.RawMessage
+}
+
+// EventEnvelope is the payload of every chaincode event
+type EventEnvelope struct {
+	SchemaVersion int
+	TxID          string
+	Timestamp     time.Time
+	Events        []EventRecord
+}
+
+// EventRecord is one typed event inside an envelope
+type EventRecord struct {
+	Type    string
+	Payload json.RawMessage
+}
+
+// Trainee mirrors the chaincode's Trainee
+type Trainee struct {
+	TraineeID      string
+	FirstName      string
+	LastName       string
+	EmailAddress   string
+	City           string
+	Nickname       string
+	ActivePlatform string
+	TotalExpPoints int `json:"totalExpPoints"`
+}
+
+// Platform mirrors the chaincode's Platform
+type Platform struct {
+	PlatformID   string
+	PlatformName string
+	EmailAddress string
+	Description  string
+}
+
+// Vlab mirrors the chaincode's Vlab
+type Vlab struct {
+	VlabID        string `json:"vlabID"`
+	BoxName       string
+	Domain        string
+	SystemType    string
+	ExpPoints     string
+	BoxDifficulty string
+	TimeNeeded    string
+}
+
+type traineeCreatedEvent struct {
+	Trainee Trainee
+}
+
+type platformCreatedEvent struct {
+	Platform Platform
+}
+
+type vlabCreatedEvent struct {
+	Vlab Vlab
+}
+
+type entityDeletedEvent struct {
+	ID         string
+	EntityType string
+}
+
+type traineePlatformEvent struct {
+	TraineeID  string
+	PlatformID string
+}
+
+type traineeTransferredEvent struct {
+	TraineeID      string
+	FromPlatformID string
+	ToPlatformID   string
+	DroppedVlabIDs []string
+}
+
+type vlabPlatformEvent struct {
+	VlabID     string
+	PlatformID string
+}
+
+type vlabAssignedEvent struct {
+	TraineeID  string
+	VlabID     string
+	PlatformID string
+}
+
+type vlabScoredEvent struct {
+	TrainerID   string
+	TraineeID   string
+	VlabID      string
+	ResultAfter string
+}
+
+type expPointsRecalculatedEvent struct {
+	TraineeID string
+	After     int
+}
@@ -0,0 +1,369 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testdata/events.jsonl was recorded from the chaincode: three trainees on
+// two platforms, two scored results, a transfer and a removal in blocks 0 to
+// 7, plus one event of another chaincode in block 5.
+const (
+	recordedEvents  = "testdata/events.jsonl"
+	recordedCode    = "ledger"
+	recordedTxs     = 23
+	recordedRecords = 28
+	recordedNext    = 8
+)
+
+// traineeRow is a row of the trainees table
+type traineeRow struct {
+	ActivePlatform string
+	TotalExpPoints int
+}
+
+// traineeVlabRow is a row of the trainee_vlabs table
+type traineeVlabRow struct {
+	PlatformID string
+	Result     string
+	ScoredBy   string
+}
+
+// readModel is what a test compares after a replay
+type readModel struct {
+	Trainees      map[string]traineeRow
+	TraineeVlabs  map[string]traineeVlabRow
+	PlatformVlabs []string
+	Transactions  int
+	Records       int
+	NextBlock     uint64
+}
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "projector.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func replay(t *testing.T, source Source, store *Store, fromBlock uint64) {
+	t.Helper()
+	if err := source.Run(context.Background(), fromBlock, &projection{store: store}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecords(t *testing.T) []ChaincodeEventRecord {
+	t.Helper()
+	file, err := os.Open(recordedEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records := []ChaincodeEventRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := ChaincodeEventRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func snapshot(t *testing.T, store *Store) readModel {
+	t.Helper()
+	model := readModel{
+		Trainees:     map[string]traineeRow{},
+		TraineeVlabs: map[string]traineeVlabRow{},
+	}
+
+	rows, err := store.db.Query("SELECT trainee_id, active_platform, total_exp_points FROM trainees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		row := traineeRow{}
+		if err := rows.Scan(&id, &row.ActivePlatform, &row.TotalExpPoints); err != nil {
+			t.Fatal(err)
+		}
+		model.Trainees[id] = row
+	}
+	rows.Close()
+
+	rows, err = store.db.Query("SELECT trainee_id, vlab_id, platform_id, result, scored_by FROM trainee_vlabs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var traineeID, vlabID string
+		row := traineeVlabRow{}
+		if err := rows.Scan(&traineeID, &vlabID, &row.PlatformID, &row.Result, &row.ScoredBy); err != nil {
+			t.Fatal(err)
+		}
+		model.TraineeVlabs[traineeID+"/"+vlabID] = row
+	}
+	rows.Close()
+
+	rows, err = store.db.Query("SELECT platform_id || '/' || vlab_id FROM platform_vlabs ORDER BY 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var pair string
+		if err := rows.Scan(&pair); err != nil {
+			t.Fatal(err)
+		}
+		model.PlatformVlabs = append(model.PlatformVlabs, pair)
+	}
+	rows.Close()
+
+	err = store.db.QueryRow("SELECT COUNT(DISTINCT tx_id), COUNT(*) FROM events").Scan(&model.Transactions, &model.Records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.NextBlock, err = store.NextBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+// checkRecordedModel checks the read model projected from the whole recording
+func checkRecordedModel(t *testing.T, model readModel) {
+	t.Helper()
+	want := readModel{
+		Trainees: map[string]traineeRow{
+			"t1": {ActivePlatform: "p1", TotalExpPoints: 80},
+			"t2": {ActivePlatform: "", TotalExpPoints: 50},
+			"t3": {ActivePlatform: "p2", TotalExpPoints: 0},
+		},
+		TraineeVlabs: map[string]traineeVlabRow{
+			"t1/v1": {PlatformID: "p1", Result: "80", ScoredBy: "Trainer1"},
+			"t2/v1": {PlatformID: "p1", Result: "50", ScoredBy: "Trainer1"},
+			"t3/v1": {PlatformID: "p2"},
+		},
+		PlatformVlabs: []string{"p1/v1", "p1/v2", "p2/v1"},
+		Transactions:  recordedTxs,
+		Records:       recordedRecords,
+		NextBlock:     recordedNext,
+	}
+	if !reflect.DeepEqual(model, want) {
+		t.Fatalf("read model\n got %+v\nwant %+v", model, want)
+	}
+}
+
+func TestEventFileReplay(t *testing.T) {
+	store := openTestStore(t)
+	replay(t, &EventFileSource{Path: recordedEvents, ChaincodeName: recordedCode}, store, 0)
+	checkRecordedModel(t, snapshot(t, store))
+}
+
+func TestEventFileReplayIsIdempotent(t *testing.T) {
+	store := openTestStore(t)
+	source := &EventFileSource{Path: recordedEvents, ChaincodeName: recordedCode}
+	replay(t, source, store, 0)
+	replay(t, source, store, 0)
+	checkRecordedModel(t, snapshot(t, store))
+
+	// A transaction already in the events table is skipped by its tx_id
+	for _, record := range readRecords(t) {
+		if record.ChaincodeName != recordedCode {
+			continue
+		}
+		applied, err := store.Apply(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied {
+			t.Fatalf("tx %s was applied twice", record.TxID)
+		}
+	}
+}
+
+func TestEventFileReplayResumesFromNextBlock(t *testing.T) {
+	// Record only blocks 0 to 3, as if the projector stopped there
+	partial := filepath.Join(t.TempDir(), "partial.jsonl")
+	lines := []string{}
+	for _, record := range readRecords(t) {
+		if record.BlockNumber > 3 {
+			break
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+	if err := os.WriteFile(partial, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := openTestStore(t)
+	replay(t, &EventFileSource{Path: partial, ChaincodeName: recordedCode}, store, 0)
+	next, err := store.NextBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 4 {
+		t.Fatalf("NextBlock after blocks 0 to 3 = %d, want 4", next)
+	}
+
+	replay(t, &EventFileSource{Path: recordedEvents, ChaincodeName: recordedCode}, store, next)
+	checkRecordedModel(t, snapshot(t, store))
+}
+
+// writeBlocks writes the recorded events as block files, one per block
+// number. Every block also carries a transaction the peer marked invalid,
+// whose event must not be projected.
+func writeBlocks(t *testing.T, records []ChaincodeEventRecord) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	byBlock := map[uint64][]ChaincodeEventRecord{}
+	for _, record := range records {
+		byBlock[record.BlockNumber] = append(byBlock[record.BlockNumber], record)
+	}
+
+	for number, blockRecords := range byBlock {
+		invalid := ChaincodeEventRecord{
+			TxID:          fmt.Sprintf("invalid%d", number),
+			ChaincodeName: recordedCode,
+			EventName:     "TraineeCreated",
+			Payload:       json.RawMessage(`{"SchemaVersion":1,"Events":[{"Type":"TraineeCreated","Payload":{"Trainee":{"TraineeID":"invalid"}}}]}`),
+		}
+		blockRecords = append(blockRecords, invalid)
+
+		block := &common.Block{
+			Header:   &common.BlockHeader{Number: number},
+			Data:     &common.BlockData{},
+			Metadata: &common.BlockMetadata{Metadata: make([][]byte, int(common.BlockMetadataIndex_TRANSACTIONS_FILTER)+1)},
+		}
+		validationCodes := []byte{}
+		for i, record := range blockRecords {
+			block.Data.Data = append(block.Data.Data, endorserTransaction(t, record))
+			code := peer.TxValidationCode_VALID
+			if i == len(blockRecords)-1 {
+				code = peer.TxValidationCode_MVCC_READ_CONFLICT
+			}
+			validationCodes = append(validationCodes, byte(code))
+		}
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = validationCodes
+
+		// Names out of block order, the headers decide
+		path := filepath.Join(dir, fmt.Sprintf("%c.block", 'z'-rune(number)))
+		if err := os.WriteFile(path, mustMarshal(t, block), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// endorserTransaction wraps a chaincode event the way a peer commits it
+func endorserTransaction(t *testing.T, record ChaincodeEventRecord) []byte {
+	event := &peer.ChaincodeEvent{
+		ChaincodeId: record.ChaincodeName,
+		TxId:        record.TxID,
+		EventName:   record.EventName,
+		Payload:     record.Payload,
+	}
+	action := &peer.ChaincodeAction{Events: mustMarshal(t, event)}
+	response := &peer.ProposalResponsePayload{Extension: mustMarshal(t, action)}
+	actionPayload := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: mustMarshal(t, response)},
+	}
+	transaction := &peer.Transaction{
+		Actions: []*peer.TransactionAction{{Payload: mustMarshal(t, actionPayload)}},
+	}
+	channelHeader := &common.ChannelHeader{
+		Type: int32(common.HeaderType_ENDORSER_TRANSACTION),
+		TxId: record.TxID,
+	}
+	payload := &common.Payload{
+		Header: &common.Header{ChannelHeader: mustMarshal(t, channelHeader)},
+		Data:   mustMarshal(t, transaction),
+	}
+	return mustMarshal(t, &common.Envelope{Payload: mustMarshal(t, payload)})
+}
+
+func mustMarshal(t *testing.T, message proto.Message) []byte {
+	t.Helper()
+	bytes, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes
+}
+
+func TestBlockFileReplay(t *testing.T) {
+	dir := writeBlocks(t, readRecords(t))
+
+	store := openTestStore(t)
+	source := &BlockFileSource{Dir: dir, ChaincodeName: recordedCode}
+	replay(t, source, store, 0)
+	checkRecordedModel(t, snapshot(t, store))
+
+	// Replaying the blocks again changes nothing
+	replay(t, source, store, 0)
+	checkRecordedModel(t, snapshot(t, store))
+}
+
+func TestBlockFileReplayResumesFromNextBlock(t *testing.T) {
+	records := readRecords(t)
+	partial := []ChaincodeEventRecord{}
+	for _, record := range records {
+		if record.BlockNumber <= 5 {
+			partial = append(partial, record)
+		}
+	}
+
+	store := openTestStore(t)
+	replay(t, &BlockFileSource{Dir: writeBlocks(t, partial), ChaincodeName: recordedCode}, store, 0)
+	next, err := store.NextBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 6 {
+		t.Fatalf("NextBlock after blocks 0 to 5 = %d, want 6", next)
+	}
+
+	replay(t, &BlockFileSource{Dir: writeBlocks(t, records), ChaincodeName: recordedCode}, store, next)
+	checkRecordedModel(t, snapshot(t, store))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+// Handler receives the chaincode events of a source in commit order
+type Handler interface {
+	// Event is called for every chaincode event
+	Event(record ChaincodeEventRecord) error
+	// BlockDone is called once every event of a block was handled. Sources
+	// that do not see block boundaries never call it.
+	BlockDone(blockNumber uint64) error
+}
+
+// Source delivers chaincode events from a block on
+type Source interface {
+	Run(ctx context.Context, fromBlock uint64, handler Handler) error
+}
+
+// EventFileSource replays a recorded event file, one ChaincodeEventRecord
+// JSON object per line, as written by the -record flag. A block is done once
+// a record of a later block or the end of the file is read.
+type EventFileSource struct {
+	Path          string
+	ChaincodeName string
+}
+
+// Run implements Source
+func (s *EventFileSource) Run(ctx context.Context, fromBlock uint64, handler Handler) error {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	line := 0
+	started := false
+	var block uint64
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record := ChaincodeEventRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.Path, line, err)
+		}
+		if record.BlockNumber < fromBlock {
+			continue
+		}
+		if started && record.BlockNumber != block {
+			if err := handler.BlockDone(block); err != nil {
+				return err
+			}
+		}
+		started = true
+		block = record.BlockNumber
+
+		if s.ChaincodeName != "" && record.ChaincodeName != s.ChaincodeName {
+			continue
+		}
+		if err := handler.Event(record); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if started {
+		return handler.BlockDone(block)
+	}
+	return nil
+}
+
+// BlockFileSource replays a directory of block files, each one a marshaled
+// common.Block as written by "peer channel fetch"
+type BlockFileSource struct {
+	Dir           string
+	ChaincodeName string
+}
+
+// Run implements Source
+func (s *BlockFileSource) Run(ctx context.Context, fromBlock uint64, handler Handler) error {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.block"))
+	if err != nil {
+		return err
+	}
+
+	blocks := []*common.Block{}
+	for _, path := range paths {
+		blockBytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		block := &common.Block{}
+		if err := proto.Unmarshal(blockBytes, block); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if block.Header == nil {
+			return fmt.Errorf("%s: block has no header", path)
+		}
+		if block.Header.Number >= fromBlock {
+			blocks = append(blocks, block)
+		}
+	}
+
+	// File names carry no ordering guarantee, the headers do
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Header.Number < blocks[j].Header.Number
+	})
+
+	for _, block := range blocks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := handleBlock(block, s.ChaincodeName, handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleBlock passes the chaincode events of a block to the handler
+func handleBlock(block *common.Block, chaincodeName string, handler Handler) error {
+	records, err := blockEvents(block, chaincodeName)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := handler.Event(record); err != nil {
+			return err
+		}
+	}
+	return handler.BlockDone(block.Header.Number)
+}
@@ -0,0 +1,350 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The read model lives in one SQLite file. Every chaincode event is applied
+// in its own SQL transaction together with the checkpoint, so a crash never
+// leaves a half applied transaction behind. Applied transaction IDs are kept
+// in the events table, which makes replaying a block that was already
+// partly projected safe.
+const schema = `
+CREATE TABLE IF NOT EXISTS trainees (
+	trainee_id       TEXT PRIMARY KEY,
+	first_name       TEXT NOT NULL DEFAULT '',
+	last_name        TEXT NOT NULL DEFAULT '',
+	email_address    TEXT NOT NULL DEFAULT '',
+	city             TEXT NOT NULL DEFAULT '',
+	nickname         TEXT NOT NULL DEFAULT '',
+	active_platform  TEXT NOT NULL DEFAULT '',
+	total_exp_points INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS platforms (
+	platform_id   TEXT PRIMARY KEY,
+	platform_name TEXT NOT NULL DEFAULT '',
+	email_address TEXT NOT NULL DEFAULT '',
+	description   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS vlabs (
+	vlab_id        TEXT PRIMARY KEY,
+	box_name       TEXT NOT NULL DEFAULT '',
+	domain         TEXT NOT NULL DEFAULT '',
+	system_type    TEXT NOT NULL DEFAULT '',
+	exp_points     TEXT NOT NULL DEFAULT '',
+	box_difficulty TEXT NOT NULL DEFAULT '',
+	time_needed    TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS platform_vlabs (
+	platform_id TEXT NOT NULL,
+	vlab_id     TEXT NOT NULL,
+	PRIMARY KEY (platform_id, vlab_id)
+);
+CREATE TABLE IF NOT EXISTS trainee_vlabs (
+	trainee_id  TEXT NOT NULL,
+	vlab_id     TEXT NOT NULL,
+	platform_id TEXT NOT NULL DEFAULT '',
+	result      TEXT NOT NULL DEFAULT '',
+	scored_by   TEXT NOT NULL DEFAULT '',
+	scored_at   TEXT,
+	PRIMARY KEY (trainee_id, vlab_id)
+);
+CREATE TABLE IF NOT EXISTS events (
+	tx_id        TEXT NOT NULL,
+	event_index  INTEGER NOT NULL,
+	block_number INTEGER NOT NULL,
+	type         TEXT NOT NULL,
+	timestamp    TEXT,
+	payload      TEXT NOT NULL,
+	PRIMARY KEY (tx_id, event_index)
+);
+CREATE TABLE IF NOT EXISTS checkpoint (
+	id         INTEGER PRIMARY KEY CHECK (id = 1),
+	next_block INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO checkpoint (id, next_block) VALUES (1, 0);
+`
+
+var readModelTables = []string{"trainees", "platforms", "vlabs", "platform_vlabs", "trainee_vlabs", "events"}
+
+// Store is the SQLite read model
+type Store struct {
+	db *sql.DB
+}
+
+// OpenStore opens or creates the read model at path
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer, keep the pool from racing itself
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// NextBlock returns the block to resume from
+func (s *Store) NextBlock() (uint64, error) {
+	var next uint64
+	err := s.db.QueryRow("SELECT next_block FROM checkpoint WHERE id = 1").Scan(&next)
+	return next, err
+}
+
+// Reset empties the read model so it can be rebuilt from the given block
+func (s *Store) Reset(fromBlock uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range readModelTables {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE checkpoint SET next_block = ? WHERE id = 1", fromBlock); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BlockDone moves the checkpoint past a block whose events were all applied
+func (s *Store) BlockDone(blockNumber uint64) error {
+	_, err := s.db.Exec("UPDATE checkpoint SET next_block = MAX(next_block, ?) WHERE id = 1", blockNumber+1)
+	return err
+}
+
+// Apply projects one chaincode event. It returns false if the transaction
+// was already applied.
+func (s *Store) Apply(record ChaincodeEventRecord) (bool, error) {
+	envelope := EventEnvelope{}
+	if err := json.Unmarshal(record.Payload, &envelope); err != nil {
+		return false, fmt.Errorf("tx %s: failed to decode event envelope: %w", record.TxID, err)
+	}
+	if envelope.SchemaVersion > supportedSchemaVersion {
+		return false, fmt.Errorf("tx %s: unsupported event schema version %d", record.TxID, envelope.SchemaVersion)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRow("SELECT COUNT(*) FROM events WHERE tx_id = ?", record.TxID).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied > 0 {
+		return false, nil
+	}
+
+	for i, event := range envelope.Events {
+		if err := applyEvent(tx, event, envelope.Timestamp); err != nil {
+			return false, fmt.Errorf("tx %s: %s: %w", record.TxID, event.Type, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO events (tx_id, event_index, block_number, type, timestamp, payload) VALUES (?, ?, ?, ?, ?, ?)",
+			record.TxID, i, record.BlockNumber, event.Type, formatTime(envelope.Timestamp), string(event.Payload))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Resume from this block, the events table skips what was applied
+	_, err = tx.Exec("UPDATE checkpoint SET next_block = MAX(next_block, ?) WHERE id = 1", record.BlockNumber)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// applyEvent updates the read model tables for one typed event. Event types
+// the read model does not cover are only kept in the events table.
+func applyEvent(tx *sql.Tx, event EventRecord, timestamp time.Time) error {
+	switch event.Type {
+	case "TraineeCreated":
+		payload := traineeCreatedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		trainee := payload.Trainee
+		_, err := tx.Exec(`INSERT OR REPLACE INTO trainees
+			(trainee_id, first_name, last_name, email_address, city, nickname, active_platform, total_exp_points)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			trainee.TraineeID, trainee.FirstName, trainee.LastName, trainee.EmailAddress, trainee.City,
+			trainee.Nickname, trainee.ActivePlatform, trainee.TotalExpPoints)
+		return err
+
+	case "PlatformCreated":
+		payload := platformCreatedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		platform := payload.Platform
+		_, err := tx.Exec(`INSERT OR REPLACE INTO platforms (platform_id, platform_name, email_address, description)
+			VALUES (?, ?, ?, ?)`,
+			platform.PlatformID, platform.PlatformName, platform.EmailAddress, platform.Description)
+		return err
+
+	case "VlabCreated":
+		payload := vlabCreatedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		vlab := payload.Vlab
+		_, err := tx.Exec(`INSERT OR REPLACE INTO vlabs
+			(vlab_id, box_name, domain, system_type, exp_points, box_difficulty, time_needed)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			vlab.VlabID, vlab.BoxName, vlab.Domain, vlab.SystemType, vlab.ExpPoints, vlab.BoxDifficulty, vlab.TimeNeeded)
+		return err
+
+	case "EntityDeleted":
+		payload := entityDeletedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		return deleteEntity(tx, payload)
+
+	case "TraineeAddedToPlatform":
+		payload := traineePlatformEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE trainees SET active_platform = ? WHERE trainee_id = ?", payload.PlatformID, payload.TraineeID)
+		return err
+
+	case "TraineeRemovedFromPlatform":
+		payload := traineePlatformEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE trainees SET active_platform = '' WHERE trainee_id = ?", payload.TraineeID)
+		return err
+
+	case "TraineeTransferred":
+		payload := traineeTransferredEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		for _, vlabID := range payload.DroppedVlabIDs {
+			_, err := tx.Exec("DELETE FROM trainee_vlabs WHERE trainee_id = ? AND vlab_id = ?", payload.TraineeID, vlabID)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec("UPDATE trainee_vlabs SET platform_id = ? WHERE trainee_id = ?", payload.ToPlatformID, payload.TraineeID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE trainees SET active_platform = ? WHERE trainee_id = ?", payload.ToPlatformID, payload.TraineeID)
+		return err
+
+	case "VlabAddedToPlatform":
+		payload := vlabPlatformEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT OR IGNORE INTO platform_vlabs (platform_id, vlab_id) VALUES (?, ?)", payload.PlatformID, payload.VlabID)
+		return err
+
+	case "VlabAssigned":
+		payload := vlabAssignedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT OR REPLACE INTO trainee_vlabs (trainee_id, vlab_id, platform_id) VALUES (?, ?, ?)",
+			payload.TraineeID, payload.VlabID, payload.PlatformID)
+		return err
+
+	case "VlabScored":
+		payload := vlabScoredEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE trainee_vlabs SET result = ?, scored_by = ?, scored_at = ? WHERE trainee_id = ? AND vlab_id = ?",
+			payload.ResultAfter, payload.TrainerID, formatTime(timestamp), payload.TraineeID, payload.VlabID)
+		return err
+
+	case "ExpPointsRecalculated":
+		payload := expPointsRecalculatedEvent{}
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE trainees SET total_exp_points = ? WHERE trainee_id = ?", payload.After, payload.TraineeID)
+		return err
+	}
+
+	return nil
+}
+
+// formatTime stores timestamps as RFC 3339 text, which SQLite's date
+// functions understand
+func formatTime(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// deleteEntity removes a deleted entity and the rows that belong to it
+func deleteEntity(tx *sql.Tx, payload entityDeletedEvent) error {
+	var statements []string
+	switch payload.EntityType {
+	case "trainee":
+		statements = []string{
+			"DELETE FROM trainee_vlabs WHERE trainee_id = ?",
+			"DELETE FROM trainees WHERE trainee_id = ?",
+		}
+	case "platform":
+		statements = []string{
+			"DELETE FROM platform_vlabs WHERE platform_id = ?",
+			"DELETE FROM platforms WHERE platform_id = ?",
+		}
+	case "vlab":
+		statements = []string{
+			"DELETE FROM platform_vlabs WHERE vlab_id = ?",
+			"DELETE FROM vlabs WHERE vlab_id = ?",
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, payload.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Rich queries require CouchDB as the state database. Each query function
+// builds its selector from structured arguments and pins it to one of the
+// indexes packaged under META-INF/statedb/couchdb/indexes, so callers cannot
+// submit arbitrary selectors that would fall back to a full scan.
+
+// couchDBQuery is the Mango query sent to GetQueryResultWithPagination
+type couchDBQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	UseIndex []string               `json:"use_index"`
+}
+
+// backfillQueryFields sets the docType of a stored entity and, for trainees,
+// the numeric copy of the experience points
+func backfillQueryFields(objectType string, value []byte) ([]byte, error) {
+	record, err := newObject(objectType)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(value, record)
+	if err != nil {
+		return nil, err
+	}
+
+	switch r := record.(type) {
+	case *Trainee:
+		r.DocType = objectType
+		expPoints, err := strconv.Atoi(r.Total_Exp_Points)
+		if err == nil {
+			setExpPoints(r, expPoints)
+		}
+	case *Platform:
+		r.DocType = objectType
+	case *Vlab:
+		r.DocType = objectType
+	case *Trainer:
+		r.DocType = objectType
+	case *Administrator:
+		r.DocType = objectType
+	case *VlabOwner:
+		r.DocType = objectType
+	}
+
+	return json.Marshal(record)
+}
+
+// runRichQuery returns one page of the entities matching the query
+func runRichQuery(stub shim.ChaincodeStubInterface, objectType string, query couchDBQuery, args []string) pb.Response {
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return shim.Error("Failed to marshal query to JSON")
+	}
+
+	resultsIterator, metadata, err := stub.GetQueryResultWithPagination(string(queryJSON), pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []interface{}{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		record, err := newObject(objectType)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = json.Unmarshal(queryResult.Value, record)
+		if err != nil {
+			return shim.Error("Failed to unmarshal " + objectType + " " + queryResult.Key + " JSON")
+		}
+		records = append(records, record)
+	}
+
+	result := PaginatedQueryResult{
+		PageSize:            pageSize,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+		Records:             records,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("Failed to marshal query result to JSON")
+	}
+
+	return shim.Success(resultJSON)
+}
+
+// queryTraineesByCity returns the trainees living in a city.
+// Arguments: city, pageSize, optional bookmark
+func (t *SimpleChaincode) queryTraineesByCity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting city, pageSize and optional bookmark")
+	}
+
+	query := couchDBQuery{
+		Selector: map[string]interface{}{
+			"docType": traineeObjectType,
+			"City":    args[0],
+		},
+		UseIndex: []string{"_design/indexTraineeCityDoc", "indexTraineeCity"},
+	}
+
+	return runRichQuery(stub, traineeObjectType, query, args[1:])
+}
+
+// queryVlabsByDomainAndDifficulty returns the vlabs of a domain and difficulty.
+// Arguments: domain, boxDifficulty, pageSize, optional bookmark
+func (t *SimpleChaincode) queryVlabsByDomainAndDifficulty(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting domain, boxDifficulty, pageSize and optional bookmark")
+	}
+
+	query := couchDBQuery{
+		Selector: map[string]interface{}{
+			"docType":       vlabObjectType,
+			"Domain":        args[0],
+			"BoxDifficulty": args[1],
+		},
+		UseIndex: []string{"_design/indexVlabDomainDifficultyDoc", "indexVlabDomainDifficulty"},
+	}
+
+	return runRichQuery(stub, vlabObjectType, query, args[2:])
+}
+
+// queryTraineesByMinExpPoints returns the trainees of a platform with more
+// than minExpPoints experience points.
+// Arguments: platformID, minExpPoints, pageSize, optional bookmark
+func (t *SimpleChaincode) queryTraineesByMinExpPoints(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID, minExpPoints, pageSize and optional bookmark")
+	}
+
+	minExpPoints, err := strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error("minExpPoints must be an integer")
+	}
+
+	query := couchDBQuery{
+		Selector: map[string]interface{}{
+			"docType":        traineeObjectType,
+			"ActivePlatform": args[0],
+			"totalExpPoints": map[string]interface{}{"$gt": minExpPoints},
+		},
+		UseIndex: []string{"_design/indexTraineePlatformExpDoc", "indexTraineePlatformExp"},
+	}
+
+	return runRichQuery(stub, traineeObjectType, query, args[2:])
+}
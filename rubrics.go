@@ -0,0 +1,311 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// A rubric splits the grading of a vlab into weighted criteria. A trainer
+// scores every criterion as a percentage, and the result of the vlab is the
+// weighted average
+//
+//	result = sum(Weight * score) / sum(Weight)
+//
+// On pass/fail platforms the result is a pass when it reaches PassMark. On
+// percentage platforms the result is kept as the percentage, and it passes
+// when it reaches PassMark, so the pass mark decides the same on every
+// platform. A rubric without a PassMark uses the platform's. The
+// per-criterion scores are kept with the trainee's vlab next to the result.
+
+// defaultPassMark is the PassMark of platforms that do not set one
+const defaultPassMark = 50
+
+// RubricCriterion is one weighted criterion of a rubric
+type RubricCriterion struct {
+	CriterionID string
+	Name        string
+	Weight      float64
+}
+
+// Rubric is the list of criteria a vlab is graded on
+type Rubric struct {
+	Criteria []RubricCriterion
+	PassMark float64 `json:"PassMark,omitempty"`
+}
+
+// CriterionSummary is the average score of a criterion over the trainees
+// graded on it
+type CriterionSummary struct {
+	CriterionID string
+	Name        string
+	Weight      float64
+	Graded      int
+	Average     float64
+}
+
+// TraineeCriterionScores are the criterion scores of one trainee
+type TraineeCriterionScores struct {
+	TraineeID       string
+	Result          string
+	CriterionScores map[string]float64
+}
+
+// CriterionResults is the skills breakdown of a vlab on a platform
+type CriterionResults struct {
+	PlatformID string
+	VlabID     string
+	Criteria   []CriterionSummary
+	Trainees   []TraineeCriterionScores
+}
+
+// validate checks a rubric submitted by a vlab owner
+func (rubric *Rubric) validate() error {
+	if len(rubric.Criteria) == 0 {
+		return fmt.Errorf("A rubric needs at least one criterion")
+	}
+	seen := map[string]bool{}
+	for _, criterion := range rubric.Criteria {
+		if criterion.CriterionID == "" {
+			return fmt.Errorf("Every criterion needs a CriterionID")
+		}
+		if seen[criterion.CriterionID] {
+			return fmt.Errorf("Criterion %s is listed twice", criterion.CriterionID)
+		}
+		seen[criterion.CriterionID] = true
+		if !(criterion.Weight > 0) || math.IsInf(criterion.Weight, 0) {
+			return fmt.Errorf("Weight of criterion %s must be positive", criterion.CriterionID)
+		}
+	}
+	if !(rubric.PassMark >= 0 && rubric.PassMark <= 100) {
+		return fmt.Errorf("PassMark must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// total returns the weighted average of scores, which must score every
+// criterion of the rubric and nothing else
+func (rubric *Rubric) total(scores map[string]float64) (float64, error) {
+	weighted := 0.0
+	weights := 0.0
+	for _, criterion := range rubric.Criteria {
+		score, exists := scores[criterion.CriterionID]
+		if !exists {
+			return 0, fmt.Errorf("Criterion %s has no score", criterion.CriterionID)
+		}
+		if !(score >= 0 && score <= 100) {
+			return 0, fmt.Errorf("Score of criterion %s must be a percentage between 0 and 100", criterion.CriterionID)
+		}
+		weighted += criterion.Weight * score
+		weights += criterion.Weight
+	}
+	if len(scores) != len(rubric.Criteria) {
+		for criterionID := range scores {
+			if !rubric.has(criterionID) {
+				return 0, fmt.Errorf("Vlab has no criterion %s", criterionID)
+			}
+		}
+	}
+	return math.Round(weighted/weights*100) / 100, nil
+}
+
+// has reports whether the rubric has a criterion
+func (rubric *Rubric) has(criterionID string) bool {
+	for _, criterion := range rubric.Criteria {
+		if criterion.CriterionID == criterionID {
+			return true
+		}
+	}
+	return false
+}
+
+// rubricResult turns a result given as a JSON object of criterion scores
+// into the vlab's result under the platform's result type. Any other result
+// is returned unchanged, without criterion scores.
+func rubricResult(vlab *Vlab, rules *ScoringRules, result string) (string, map[string]float64, error) {
+	if !strings.HasPrefix(strings.TrimSpace(result), "{") {
+		return result, nil, nil
+	}
+	if vlab.Rubric == nil {
+		return "", nil, fmt.Errorf("Vlab %s has no rubric to score criteria against", vlab.VlabID)
+	}
+
+	scores := map[string]float64{}
+	err := json.Unmarshal([]byte(result), &scores)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to unmarshal criterion scores JSON")
+	}
+
+	total, err := vlab.Rubric.total(scores)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if rules.ResultType == PassFailResultType {
+		if total >= rules.passMark(*vlab) {
+			return "pass", scores, nil
+		}
+		return "fail", scores, nil
+	}
+	return strconv.FormatFloat(total, 'f', -1, 64), scores, nil
+}
+
+// setVlabRubric replaces the rubric of a vlab, given as a JSON object such as
+// {"Criteria":[{"CriterionID":"enum","Name":"Enumeration","Weight":1}],"PassMark":60}.
+// An empty argument removes the rubric.
+// Arguments: vlabOwnerID or administratorID, vlabID, rubric
+func (t *SimpleChaincode) setVlabRubric(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting vlabOwnerID or administratorID, vlabID and rubric")
+	}
+
+	callerID := args[0]
+	vlabID := args[1]
+
+	// Check if callerID starts with "vlabowner" or "admin"
+	if !strings.HasPrefix(callerID, "vlabowner") && !strings.HasPrefix(callerID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	var rubric *Rubric
+	if args[2] != "" {
+		rubric = &Rubric{}
+		err := json.Unmarshal([]byte(args[2]), rubric)
+		if err != nil {
+			return shim.Error("Failed to unmarshal rubric JSON")
+		}
+		err = rubric.validate()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	vlab, err := getVlabRecord(stub, vlabID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	vlab.Rubric = rubric
+
+	vlabJSON, err := json.Marshal(vlab)
+	if err != nil {
+		return shim.Error("Failed to marshal vlab to JSON")
+	}
+	err = stub.PutState(vlabID, vlabJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, VlabRubricSetEventType, VlabRubricSetEvent{
+		CallerID: callerID,
+		VlabID:   vlabID,
+		Rubric:   rubric,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getCriterionResults returns the criterion scores of the trainees of a
+// platform for a vlab, with the average of every criterion of its rubric.
+// Arguments: platformID, vlabID
+func (t *SimpleChaincode) getCriterionResults(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and vlabID")
+	}
+
+	platformID := args[0]
+	vlabID := args[1]
+
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error("Failed to unmarshal platform JSON")
+	}
+
+	vlab, err := getVlabRecord(stub, vlabID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	results := CriterionResults{
+		PlatformID: platformID,
+		VlabID:     vlabID,
+		Criteria:   []CriterionSummary{},
+		Trainees:   []TraineeCriterionScores{},
+	}
+
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, trainee := range platform.Trainees {
+		assigned, exists := trainee.VlabPointsMap2[vlabID]
+		if !exists || len(assigned.CriterionScores) == 0 {
+			continue
+		}
+		results.Trainees = append(results.Trainees, TraineeCriterionScores{
+			TraineeID:       trainee.TraineeID,
+			Result:          assigned.Result,
+			CriterionScores: assigned.CriterionScores,
+		})
+		for criterionID, score := range assigned.CriterionScores {
+			sums[criterionID] += score
+			counts[criterionID]++
+		}
+	}
+	sort.Slice(results.Trainees, func(i, j int) bool {
+		return results.Trainees[i].TraineeID < results.Trainees[j].TraineeID
+	})
+
+	if vlab.Rubric != nil {
+		for _, criterion := range vlab.Rubric.Criteria {
+			summary := CriterionSummary{
+				CriterionID: criterion.CriterionID,
+				Name:        criterion.Name,
+				Weight:      criterion.Weight,
+				Graded:      counts[criterion.CriterionID],
+			}
+			if summary.Graded > 0 {
+				summary.Average = math.Round(sums[criterion.CriterionID]/float64(summary.Graded)*100) / 100
+			}
+			results.Criteria = append(results.Criteria, summary)
+		}
+	}
+
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return shim.Error("Failed to marshal criterion results to JSON")
+	}
+
+	return shim.Success(resultsJSON)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRubricResult(t *testing.T) {
+	percentage := defaultScoringRules("p1")
+	passFail := defaultScoringRules("p1")
+	passFail.ResultType = PassFailResultType
+	strictPassFail := defaultScoringRules("p1")
+	strictPassFail.ResultType = PassFailResultType
+	strictPassFail.PassMark = 70
+	criteria := []RubricCriterion{{CriterionID: "enum", Weight: 1}, {CriterionID: "exploit", Weight: 3}}
+	marked := &Rubric{Criteria: criteria, PassMark: 60}
+	unmarked := &Rubric{Criteria: criteria}
+
+	tests := []struct {
+		name    string
+		rules   *ScoringRules
+		rubric  *Rubric
+		result  string
+		want    string
+		scored  bool
+		wantErr bool
+	}{
+		{"plain result", percentage, marked, "75", "75", false, false},
+		{"plain result without rubric", percentage, nil, "pass", "pass", false, false},
+		{"weighted average", percentage, marked, `{"enum":100,"exploit":50}`, "62.5", true, false},
+		{"rounded average", percentage, marked, `{"enum":33,"exploit":33.333}`, "33.25", true, false},
+		{"at the rubric pass mark", passFail, marked, `{"enum":60,"exploit":60}`, "pass", true, false},
+		{"below the rubric pass mark", passFail, marked, `{"enum":100,"exploit":40}`, "fail", true, false},
+		{"default pass mark", passFail, unmarked, `{"enum":100,"exploit":40}`, "pass", true, false},
+		{"platform pass mark", strictPassFail, unmarked, `{"enum":100,"exploit":50}`, "fail", true, false},
+		{"rubric pass mark over platform's", strictPassFail, marked, `{"enum":100,"exploit":50}`, "pass", true, false},
+		{"no rubric", percentage, nil, `{"enum":100}`, "", false, true},
+		{"not JSON", percentage, marked, `{"enum":`, "", false, true},
+		{"missing criterion", percentage, marked, `{"enum":100}`, "", false, true},
+		{"unknown criterion", percentage, marked, `{"enum":100,"exploit":50,"report":90}`, "", false, true},
+		{"score over 100", percentage, marked, `{"enum":120,"exploit":50}`, "", false, true},
+	}
+	for _, test := range tests {
+		vlab := &Vlab{VlabID: "v1", Rubric: test.rubric}
+		got, scores, err := rubricResult(vlab, test.rules, test.result)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: rubricResult error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: rubricResult = %q, want %q", test.name, got, test.want)
+		}
+		if (scores != nil) != test.scored {
+			t.Errorf("%s: criterion scores = %v, want scores %v", test.name, scores, test.scored)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Scoring rules are kept per platform under the composite key
+//
+//	scoringrules \x00 platformID \x00
+//
+// A trainer records a result, and the points awarded for it are derived from
+// the vlab's ExpPoints:
+//
+//	awarded = ExpPoints * fraction * multiplier * (1 + time bonus) * (1 - late penalty)
+//
+// fraction is the percentage / 100, or 1 for a pass and 0 for a fail.
+// multiplier is looked up by the vlab's BoxDifficulty and defaults to 1.
+// The time bonus grows linearly from 0 when the vlab took its full TimeNeeded
+// to TimeBonus when it took no time at all. The late penalty is LatePenalty
+// for every started day the result was recorded after the assignment's
+// deadline, up to all of the points. With HardCutoff, results after the
+// deadline are refused instead.
+//
+// A result passes, e.g. to meet a prerequisite, if it is a pass on pass/fail
+// platforms or reaches the pass mark on percentage platforms: the PassMark of
+// the vlab's rubric, else the platform's PassMark, else defaultPassMark.
+const scoringRulesObjectType = "scoringrules"
+
+// Result types of the scoring rules
+const (
+	PercentageResultType = "percentage"
+	PassFailResultType   = "passfail"
+)
+
+// ScoringRules configures how a platform turns results into points
+type ScoringRules struct {
+	DocType               string `json:"docType"`
+	PlatformID            string
+	ResultType            string
+	DifficultyMultipliers map[string]float64
+	TimeBonus             float64
+	LatePenalty           float64
+	HardCutoff            bool
+	PassMark              float64 `json:"PassMark,omitempty"`
+}
+
+// defaultScoringRules apply to platforms that were never configured
+func defaultScoringRules(platformID string) *ScoringRules {
+	return &ScoringRules{
+		DocType:               scoringRulesObjectType,
+		PlatformID:            platformID,
+		ResultType:            PercentageResultType,
+		DifficultyMultipliers: map[string]float64{},
+	}
+}
+
+// validate checks rules submitted by an administrator
+func (rules *ScoringRules) validate() error {
+	if rules.ResultType != PercentageResultType && rules.ResultType != PassFailResultType {
+		return fmt.Errorf("ResultType must be %s or %s", PercentageResultType, PassFailResultType)
+	}
+	for difficulty, multiplier := range rules.DifficultyMultipliers {
+		if multiplier < 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+			return fmt.Errorf("Multiplier of difficulty %s must not be negative", difficulty)
+		}
+	}
+	if rules.TimeBonus < 0 || math.IsNaN(rules.TimeBonus) || math.IsInf(rules.TimeBonus, 0) {
+		return fmt.Errorf("TimeBonus must not be negative")
+	}
+	if !(rules.LatePenalty >= 0 && rules.LatePenalty <= 1) {
+		return fmt.Errorf("LatePenalty must be between 0 and 1")
+	}
+	if !(rules.PassMark >= 0 && rules.PassMark <= 100) {
+		return fmt.Errorf("PassMark must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// resultFraction returns the share of a vlab's points a result earns
+func (rules *ScoringRules) resultFraction(result string) (float64, error) {
+	if rules.ResultType == PassFailResultType {
+		switch strings.ToLower(result) {
+		case "pass":
+			return 1, nil
+		case "fail":
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Result must be pass or fail")
+	}
+
+	percentage, err := strconv.ParseFloat(result, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("Result must be a percentage between 0 and 100")
+	}
+	return percentage / 100, nil
+}
+
+// passMark returns the percentage a vlab's result needs to pass
+func (rules *ScoringRules) passMark(vlab Vlab) float64 {
+	if vlab.Rubric != nil && vlab.Rubric.PassMark != 0 {
+		return vlab.Rubric.PassMark
+	}
+	if rules.PassMark != 0 {
+		return rules.PassMark
+	}
+	return defaultPassMark
+}
+
+// passes reports whether a vlab's result is a passing one
+func (rules *ScoringRules) passes(vlab Vlab) bool {
+	if rules.ResultType == PassFailResultType {
+		return strings.EqualFold(vlab.Result, "pass")
+	}
+
+	percentage, err := strconv.ParseFloat(vlab.Result, 64)
+	if err != nil {
+		return false
+	}
+	return percentage >= rules.passMark(vlab)
+}
+
+// award returns the points a vlab's result earns under the rules. An empty
+// result earns nothing.
+func (rules *ScoringRules) award(vlab Vlab) (int, error) {
+	if vlab.Result == "" {
+		return 0, nil
+	}
+
+	fraction, err := rules.resultFraction(vlab.Result)
+	if err != nil {
+		return 0, err
+	}
+
+	expPoints, err := strconv.Atoi(vlab.ExpPoints)
+	if err != nil {
+		return 0, fmt.Errorf("ExpPoints of vlab %s must be an integer", vlab.VlabID)
+	}
+
+	multiplier, exists := rules.DifficultyMultipliers[vlab.BoxDifficulty]
+	if !exists {
+		multiplier = 1
+	}
+
+	bonus := 0.0
+	if vlab.TimeSpent != "" && rules.TimeBonus > 0 {
+		timeSpent, err := strconv.ParseFloat(vlab.TimeSpent, 64)
+		if err != nil {
+			return 0, fmt.Errorf("timeSpent must be a number")
+		}
+		timeNeeded, err := strconv.ParseFloat(vlab.TimeNeeded, 64)
+		if err == nil && timeNeeded > 0 && timeSpent < timeNeeded {
+			bonus = rules.TimeBonus * (timeNeeded - timeSpent) / timeNeeded
+		}
+	}
+
+	penalty := 0.0
+	if vlab.Deadline != nil && vlab.GradedAt != nil && vlab.GradedAt.After(*vlab.Deadline) {
+		daysLate := math.Ceil(vlab.GradedAt.Sub(*vlab.Deadline).Hours() / 24)
+		penalty = math.Min(1, rules.LatePenalty*daysLate)
+	}
+
+	return int(math.Round(float64(expPoints) * fraction * multiplier * (1 + bonus) * (1 - penalty))), nil
+}
+
+// legacyResult reports whether a result was recorded before scoring rules,
+// when a result was the points themselves: it has no grading time and no
+// competition event
+func legacyResult(vlab Vlab) bool {
+	return vlab.Result != "" && vlab.GradedAt == nil && vlab.EventID == ""
+}
+
+// awardResult returns the points a vlab's result earns under the rules. A
+// legacy result the rules reject keeps the points it counted for before, its
+// integer value.
+func (rules *ScoringRules) awardResult(vlab Vlab) (int, error) {
+	points, err := rules.award(vlab)
+	if err == nil || !legacyResult(vlab) {
+		return points, err
+	}
+
+	legacyPoints, atoiErr := strconv.Atoi(vlab.Result)
+	if atoiErr != nil || legacyPoints < 0 {
+		return 0, err
+	}
+	return legacyPoints, nil
+}
+
+// backfillAwardedPoints awards the legacy results of a trainee that have no
+// points yet under the scoring rules of the trainee's platform. It reports
+// whether any result changed.
+func backfillAwardedPoints(stub shim.ChaincodeStubInterface, trainee *Trainee) (bool, error) {
+	var rules *ScoringRules
+	changed := false
+	for vlabID, vlab := range trainee.VlabPointsMap2 {
+		if !legacyResult(vlab) || vlab.AwardedPoints != 0 {
+			continue
+		}
+		if rules == nil {
+			var err error
+			rules, err = getScoringRulesRecord(stub, trainee.ActivePlatform)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		points, err := rules.awardResult(vlab)
+		if err != nil {
+			// Nothing to count it for
+			continue
+		}
+		if points != 0 {
+			vlab.AwardedPoints = points
+			trainee.VlabPointsMap2[vlabID] = vlab
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// getScoringRulesRecord reads a platform's scoring rules, or the defaults if
+// none were set
+func getScoringRulesRecord(stub shim.ChaincodeStubInterface, platformID string) (*ScoringRules, error) {
+	rulesKey, err := stub.CreateCompositeKey(scoringRulesObjectType, []string{platformID})
+	if err != nil {
+		return nil, err
+	}
+
+	rulesBytes, err := stub.GetState(rulesKey)
+	if err != nil {
+		return nil, err
+	}
+	if rulesBytes == nil {
+		return defaultScoringRules(platformID), nil
+	}
+
+	rules := &ScoringRules{}
+	err = json.Unmarshal(rulesBytes, rules)
+	if err != nil {
+		return nil, err
+	}
+	if rules.DifficultyMultipliers == nil {
+		rules.DifficultyMultipliers = map[string]float64{}
+	}
+	return rules, nil
+}
+
+// setScoringRules stores the scoring rules of a platform. Results recorded
+// before keep their points until calculateExpPoints re-scores the platform.
+// Arguments: administratorID, platformID, rules JSON
+// e.g. {"ResultType":"percentage","DifficultyMultipliers":{"Easy":1,"Hard":2},"TimeBonus":0.25,"LatePenalty":0.1}
+func (t *SimpleChaincode) setScoringRules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID and rules")
+	}
+
+	administratorID := args[0]
+	platformID := args[1]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	// Check that the platform exists
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+
+	rules := defaultScoringRules(platformID)
+	err = json.Unmarshal([]byte(args[2]), rules)
+	if err != nil {
+		return shim.Error("Failed to unmarshal scoring rules JSON")
+	}
+	rules.DocType = scoringRulesObjectType
+	rules.PlatformID = platformID
+	err = rules.validate()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return shim.Error("Failed to marshal scoring rules to JSON")
+	}
+
+	rulesKey, err := stub.CreateCompositeKey(scoringRulesObjectType, []string{platformID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(rulesKey, rulesJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, ScoringRulesSetEventType, ScoringRulesSetEvent{
+		AdministratorID: administratorID,
+		Rules:           *rules,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getScoringRules returns the scoring rules in force on a platform.
+// Arguments: platformID
+func (t *SimpleChaincode) getScoringRules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	rules, err := getScoringRulesRecord(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return shim.Error("Failed to marshal scoring rules to JSON")
+	}
+
+	return shim.Success(rulesJSON)
+}
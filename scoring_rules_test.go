@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoringRulesPasses(t *testing.T) {
+	percentage := defaultScoringRules("p1")
+	strict := defaultScoringRules("p1")
+	strict.PassMark = 80
+	passFail := defaultScoringRules("p1")
+	passFail.ResultType = PassFailResultType
+	rubric := &Rubric{Criteria: []RubricCriterion{{CriterionID: "enum", Weight: 1}}, PassMark: 70}
+	unmarked := &Rubric{Criteria: []RubricCriterion{{CriterionID: "enum", Weight: 1}}}
+
+	tests := []struct {
+		name   string
+		rules  *ScoringRules
+		rubric *Rubric
+		result string
+		want   bool
+	}{
+		{"no result", percentage, nil, "", false},
+		{"1%", percentage, nil, "1", false},
+		{"below default pass mark", percentage, nil, "49.9", false},
+		{"default pass mark", percentage, nil, "50", true},
+		{"full marks", percentage, nil, "100", true},
+		{"below platform pass mark", strict, nil, "79", false},
+		{"platform pass mark", strict, nil, "80", true},
+		{"not a percentage", percentage, nil, "pass", false},
+		{"pass", passFail, nil, "pass", true},
+		{"pass in capitals", passFail, nil, "PASS", true},
+		{"fail", passFail, nil, "fail", false},
+		{"percentage on pass/fail platform", passFail, nil, "100", false},
+		{"below rubric pass mark", percentage, rubric, "65", false},
+		{"rubric pass mark", percentage, rubric, "70", true},
+		{"rubric pass mark over platform's", strict, rubric, "75", true},
+		{"rubric without pass mark", strict, unmarked, "75", false},
+		{"pass by rubric on pass/fail platform", passFail, rubric, "pass", true},
+	}
+	for _, test := range tests {
+		got := test.rules.passes(Vlab{VlabID: "v1", Result: test.result, Rubric: test.rubric})
+		if got != test.want {
+			t.Errorf("%s: passes(%q) = %v, want %v", test.name, test.result, got, test.want)
+		}
+	}
+}
+
+func TestScoringRulesAward(t *testing.T) {
+	percentage := defaultScoringRules("p1")
+	passFail := defaultScoringRules("p1")
+	passFail.ResultType = PassFailResultType
+	multiplied := defaultScoringRules("p1")
+	multiplied.DifficultyMultipliers = map[string]float64{"Easy": 1, "Hard": 2}
+	timed := defaultScoringRules("p1")
+	timed.TimeBonus = 0.25
+	late := defaultScoringRules("p1")
+	late.LatePenalty = 0.1
+	deadline := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		gradedAt := deadline.Add(d)
+		return &gradedAt
+	}
+
+	tests := []struct {
+		name    string
+		rules   *ScoringRules
+		vlab    Vlab
+		want    int
+		wantErr bool
+	}{
+		{"no result", percentage, Vlab{ExpPoints: "100"}, 0, false},
+		{"percentage", percentage, Vlab{ExpPoints: "100", Result: "80"}, 80, false},
+		{"fractional percentage", percentage, Vlab{ExpPoints: "100", Result: "62.5"}, 63, false},
+		{"percentage over 100", percentage, Vlab{ExpPoints: "100", Result: "101"}, 0, true},
+		{"negative percentage", percentage, Vlab{ExpPoints: "100", Result: "-1"}, 0, true},
+		{"not a percentage", percentage, Vlab{ExpPoints: "100", Result: "pass"}, 0, true},
+		{"pass", passFail, Vlab{ExpPoints: "100", Result: "Pass"}, 100, false},
+		{"fail", passFail, Vlab{ExpPoints: "100", Result: "fail"}, 0, false},
+		{"percentage on pass/fail platform", passFail, Vlab{ExpPoints: "100", Result: "80"}, 0, true},
+		{"ExpPoints not an integer", percentage, Vlab{ExpPoints: "lots", Result: "80"}, 0, true},
+		{"difficulty multiplier", multiplied, Vlab{ExpPoints: "200", BoxDifficulty: "Hard", Result: "50"}, 200, false},
+		{"unlisted difficulty", multiplied, Vlab{ExpPoints: "200", BoxDifficulty: "Insane", Result: "50"}, 100, false},
+		{"half the time", timed, Vlab{ExpPoints: "100", TimeNeeded: "60", TimeSpent: "30", Result: "100"}, 113, false},
+		{"no time", timed, Vlab{ExpPoints: "100", TimeNeeded: "60", TimeSpent: "0", Result: "100"}, 125, false},
+		{"over the time", timed, Vlab{ExpPoints: "100", TimeNeeded: "60", TimeSpent: "90", Result: "100"}, 100, false},
+		{"time not reported", timed, Vlab{ExpPoints: "100", TimeNeeded: "60", Result: "100"}, 100, false},
+		{"time not a number", timed, Vlab{ExpPoints: "100", TimeNeeded: "60", TimeSpent: "soon", Result: "100"}, 0, true},
+		{"on the deadline", late, Vlab{ExpPoints: "100", Deadline: &deadline, GradedAt: at(0), Result: "100"}, 100, false},
+		{"an hour late", late, Vlab{ExpPoints: "100", Deadline: &deadline, GradedAt: at(time.Hour), Result: "100"}, 90, false},
+		{"a day and an hour late", late, Vlab{ExpPoints: "100", Deadline: &deadline, GradedAt: at(25 * time.Hour), Result: "100"}, 80, false},
+		{"too late for any points", late, Vlab{ExpPoints: "100", Deadline: &deadline, GradedAt: at(20 * 24 * time.Hour), Result: "100"}, 0, false},
+	}
+	for _, test := range tests {
+		got, err := test.rules.award(test.vlab)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: award error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: award = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScoringRulesAwardResult(t *testing.T) {
+	rules := defaultScoringRules("p1")
+	gradedAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		vlab    Vlab
+		want    int
+		wantErr bool
+	}{
+		{"legacy percentage", Vlab{ExpPoints: "100", Result: "80"}, 80, false},
+		// Results that are no percentage count for the points they were
+		{"legacy points", Vlab{ExpPoints: "100", Result: "150"}, 150, false},
+		{"legacy negative points", Vlab{ExpPoints: "100", Result: "-5"}, 0, true},
+		{"legacy text", Vlab{ExpPoints: "100", Result: "done"}, 0, true},
+		{"graded result", Vlab{ExpPoints: "100", Result: "150", GradedAt: &gradedAt}, 0, true},
+		{"event result", Vlab{ExpPoints: "100", Result: "150", EventID: "e1"}, 0, true},
+	}
+	for _, test := range tests {
+		got, err := rules.awardResult(test.vlab)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: awardResult error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: awardResult = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Closed seasons are archived under the composite key
+//
+//	seasonarchive \x00 platformID \x00 season \x00
+//
+// with the season number zero-padded so that the archives list in order.
+// An archive is written once and never changed.
+//
+// Closing a season marks every scored vlab of its trainees with the season
+// number in ClosedSeason. A trainee's Total_Exp_Points is CarriedOver, the
+// carried-over share of the last closed season, plus the points awarded for
+// the unmarked vlabs. The awarded points of marked vlabs are kept, but a
+// later change to them, such as an upheld dispute, a dynamic re-award or a
+// vlab dropped on a transfer, no longer touches the total.
+const seasonArchiveObjectType = "seasonarchive"
+
+// SeasonStanding is the final standing of a trainee in a season
+type SeasonStanding struct {
+	Rank           int
+	TraineeID      string
+	Nickname       string
+	TotalExpPoints int
+	Level          string
+	CarriedOver    int
+}
+
+// SeasonArchive is the immutable record of a closed season
+type SeasonArchive struct {
+	DocType    string `json:"docType"`
+	PlatformID string
+	Season     int
+	Name       string     `json:"Name,omitempty"`
+	StartedAt  *time.Time `json:"StartedAt,omitempty"`
+	ClosedAt   time.Time
+	ClosedBy   string
+	CarryOver  float64
+	Standings  []SeasonStanding
+}
+
+// SeasonSummary describes a closed season without its standings
+type SeasonSummary struct {
+	Season    int
+	Name      string     `json:"Name,omitempty"`
+	StartedAt *time.Time `json:"StartedAt,omitempty"`
+	ClosedAt  time.Time
+	CarryOver float64
+	Trainees  int
+}
+
+// seasonArchiveKey returns the key of a platform's season archive
+func seasonArchiveKey(stub shim.ChaincodeStubInterface, platformID string, season int) (string, error) {
+	return stub.CreateCompositeKey(seasonArchiveObjectType, []string{platformID, fmt.Sprintf("%06d", season)})
+}
+
+// rankTrainees orders trainees the way the leaderboard does: most experience
+// points first, ties broken by the earlier last completion
+func rankTrainees(trainees []Trainee) {
+	sort.SliceStable(trainees, func(i, j int) bool {
+		if trainees[i].TotalExpPoints != trainees[j].TotalExpPoints {
+			return trainees[i].TotalExpPoints > trainees[j].TotalExpPoints
+		}
+		if trainees[i].LastCompletion.IsZero() != trainees[j].LastCompletion.IsZero() {
+			return trainees[j].LastCompletion.IsZero()
+		}
+		if !trainees[i].LastCompletion.Equal(trainees[j].LastCompletion) {
+			return trainees[i].LastCompletion.Before(trainees[j].LastCompletion)
+		}
+		return trainees[i].TraineeID < trainees[j].TraineeID
+	})
+}
+
+// closeVlabs marks the scored vlabs of a trainee that count in the current
+// season as counting in the closed season
+func closeVlabs(trainee *Trainee, season int) {
+	for vlabID, vlab := range trainee.VlabPointsMap2 {
+		if vlab.Result != "" && vlab.ClosedSeason == 0 {
+			vlab.ClosedSeason = season
+			trainee.VlabPointsMap2[vlabID] = vlab
+		}
+	}
+}
+
+// closeSeason archives the standings of a platform's current season and
+// starts the next one. Every trainee of the platform keeps carryOver times
+// the season's points, 0 by default. The whole platform is closed in one
+// transaction so that the archive is a consistent snapshot.
+// Arguments: administratorID, platformID, optional season name, optional carryOver between 0 and 1
+func (t *SimpleChaincode) closeSeason(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID, optional name and optional carryOver")
+	}
+
+	administratorID := args[0]
+	platformID := args[1]
+	name := ""
+	if len(args) > 2 {
+		name = args[2]
+	}
+	carryOver := 0.0
+	if len(args) > 3 && args[3] != "" {
+		fraction, err := strconv.ParseFloat(args[3], 64)
+		if err != nil || !(fraction >= 0 && fraction <= 1) {
+			return shim.Error("carryOver must be a number between 0 and 1")
+		}
+		carryOver = fraction
+	}
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error("Failed to unmarshal platform JSON")
+	}
+
+	closedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Rank the trainees by their ledger records, which the platform's
+	// copies may lag behind
+	trainees := []Trainee{}
+	for _, member := range platform.Trainees {
+		trainee, err := getTraineeRecord(stub, member.TraineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		trainees = append(trainees, *trainee)
+	}
+	rankTrainees(trainees)
+
+	archive := SeasonArchive{
+		DocType:    seasonArchiveObjectType,
+		PlatformID: platformID,
+		Season:     platform.Season + 1,
+		Name:       name,
+		StartedAt:  platform.SeasonStartedAt,
+		ClosedAt:   closedAt,
+		ClosedBy:   administratorID,
+		CarryOver:  carryOver,
+		Standings:  []SeasonStanding{},
+	}
+
+	for i := range trainees {
+		trainee := &trainees[i]
+		carried := int(math.Round(float64(trainee.TotalExpPoints) * carryOver))
+		archive.Standings = append(archive.Standings, SeasonStanding{
+			Rank:           i + 1,
+			TraineeID:      trainee.TraineeID,
+			Nickname:       trainee.Nickname,
+			TotalExpPoints: trainee.TotalExpPoints,
+			Level:          trainee.Level,
+			CarriedOver:    carried,
+		})
+
+		// Start the next season from the carried-over points
+		previous := *trainee
+		trainee.CarriedOver = carried
+		closeVlabs(trainee, archive.Season)
+		err = recalculateExpPoints(stub, trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for j := range platform.Trainees {
+			if platform.Trainees[j].TraineeID == trainee.TraineeID {
+				platform.Trainees[j].CarriedOver = carried
+				closeVlabs(&platform.Trainees[j], archive.Season)
+				setExpPoints(&platform.Trainees[j], trainee.TotalExpPoints)
+				platform.Trainees[j].Level = trainee.Level
+				break
+			}
+		}
+
+		traineeJSON, err := json.Marshal(trainee)
+		if err != nil {
+			return shim.Error("Failed to marshal updated trainee to JSON")
+		}
+		err = stub.PutState(trainee.TraineeID, traineeJSON)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		err = updateLeaderboard(stub, &previous, trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		err = emitExpPointsChange(stub, &previous, trainee)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	archiveKey, err := seasonArchiveKey(stub, platformID, archive.Season)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	archiveJSON, err := json.Marshal(archive)
+	if err != nil {
+		return shim.Error("Failed to marshal season archive to JSON")
+	}
+	err = stub.PutState(archiveKey, archiveJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	platform.Season = archive.Season
+	platform.SeasonStartedAt = &closedAt
+	platformJSON, err := json.Marshal(platform)
+	if err != nil {
+		return shim.Error("Failed to marshal updated Platform to JSON")
+	}
+	err = stub.PutState(platformID, platformJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, SeasonClosedEventType, SeasonClosedEvent{
+		AdministratorID: administratorID,
+		PlatformID:      platformID,
+		Season:          archive.Season,
+		Name:            name,
+		CarryOver:       carryOver,
+		Trainees:        len(archive.Standings),
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(strconv.Itoa(archive.Season)))
+}
+
+// getSeasonStandings returns the archived standings of a closed season.
+// Arguments: platformID, season number
+func (t *SimpleChaincode) getSeasonStandings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and season")
+	}
+
+	season, err := strconv.Atoi(args[1])
+	if err != nil || season < 1 {
+		return shim.Error("season must be a positive integer")
+	}
+
+	archiveKey, err := seasonArchiveKey(stub, args[0], season)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	archiveBytes, err := stub.GetState(archiveKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if archiveBytes == nil {
+		return shim.Error("Season is not closed")
+	}
+
+	return shim.Success(archiveBytes)
+}
+
+// listSeasons returns the closed seasons of a platform in order, without
+// their standings.
+// Arguments: platformID
+func (t *SimpleChaincode) listSeasons(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(seasonArchiveObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	seasons := []SeasonSummary{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		archive := SeasonArchive{}
+		err = json.Unmarshal(queryResult.Value, &archive)
+		if err != nil {
+			return shim.Error("Failed to unmarshal season archive JSON")
+		}
+		seasons = append(seasons, SeasonSummary{
+			Season:    archive.Season,
+			Name:      archive.Name,
+			StartedAt: archive.StartedAt,
+			ClosedAt:  archive.ClosedAt,
+			CarryOver: archive.CarryOver,
+			Trainees:  len(archive.Standings),
+		})
+	}
+
+	seasonsJSON, err := json.Marshal(seasons)
+	if err != nil {
+		return shim.Error("Failed to marshal seasons to JSON")
+	}
+
+	return shim.Success(seasonsJSON)
+}
@@ -0,0 +1,549 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Teams live under two composite keys
+//
+//	team \x00 platformID \x00 teamID \x00
+//	teammember \x00 platformID \x00 traineeID \x00    the team ID
+//
+// The member index holds one team per trainee and platform, which is how a
+// trainee is kept to a single team. A trainee who leaves the platform leaves
+// the team as well.
+const (
+	teamObjectType       = "team"
+	teamMemberObjectType = "teammember"
+)
+
+// Team is a group of trainees of a platform. Cohort optionally groups teams
+// that compete with each other.
+type Team struct {
+	DocType    string `json:"docType"`
+	TeamID     string
+	PlatformID string
+	Name       string
+	Cohort     string `json:"Cohort,omitempty"`
+	Members    []string
+	CreatedBy  string
+}
+
+// TeamStanding is one row of a team leaderboard. Points and completed vlabs
+// add up the members' results on the platform.
+type TeamStanding struct {
+	Rank           int
+	TeamID         string
+	Name           string
+	Cohort         string `json:"Cohort,omitempty"`
+	Members        int
+	TotalExpPoints int
+	AveragePoints  float64
+	CompletedVlabs int
+}
+
+// getTeamRecord reads a team, or nil if it does not exist
+func getTeamRecord(stub shim.ChaincodeStubInterface, platformID string, teamID string) (*Team, error) {
+	teamKey, err := stub.CreateCompositeKey(teamObjectType, []string{platformID, teamID})
+	if err != nil {
+		return nil, err
+	}
+
+	teamBytes, err := stub.GetState(teamKey)
+	if err != nil {
+		return nil, err
+	}
+	if teamBytes == nil {
+		return nil, nil
+	}
+
+	team := &Team{}
+	err = json.Unmarshal(teamBytes, team)
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// putTeam saves a team
+func putTeam(stub shim.ChaincodeStubInterface, team *Team) error {
+	teamJSON, err := json.Marshal(team)
+	if err != nil {
+		return err
+	}
+
+	teamKey, err := stub.CreateCompositeKey(teamObjectType, []string{team.PlatformID, team.TeamID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(teamKey, teamJSON)
+}
+
+// teamOf returns the ID of the trainee's team on a platform, or "" if the
+// trainee is in none
+func teamOf(stub shim.ChaincodeStubInterface, platformID string, traineeID string) (string, error) {
+	memberKey, err := stub.CreateCompositeKey(teamMemberObjectType, []string{platformID, traineeID})
+	if err != nil {
+		return "", err
+	}
+
+	teamBytes, err := stub.GetState(memberKey)
+	if err != nil {
+		return "", err
+	}
+	return string(teamBytes), nil
+}
+
+// joinTeam adds a trainee to a team and indexes the membership
+func joinTeam(stub shim.ChaincodeStubInterface, team *Team, traineeID string) error {
+	team.Members = append(team.Members, traineeID)
+	sort.Strings(team.Members)
+	err := putTeam(stub, team)
+	if err != nil {
+		return err
+	}
+
+	memberKey, err := stub.CreateCompositeKey(teamMemberObjectType, []string{team.PlatformID, traineeID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(memberKey, []byte(team.TeamID))
+}
+
+// quitTeam takes a trainee off a team and drops the membership index
+func quitTeam(stub shim.ChaincodeStubInterface, team *Team, traineeID string) error {
+	members := []string{}
+	for _, member := range team.Members {
+		if member != traineeID {
+			members = append(members, member)
+		}
+	}
+	team.Members = members
+	err := putTeam(stub, team)
+	if err != nil {
+		return err
+	}
+
+	memberKey, err := stub.CreateCompositeKey(teamMemberObjectType, []string{team.PlatformID, traineeID})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(memberKey)
+}
+
+// leaveTeam takes a trainee who leaves a platform off the team the trainee
+// has there, if any
+func leaveTeam(stub shim.ChaincodeStubInterface, callerID string, platformID string, traineeID string) error {
+	teamID, err := teamOf(stub, platformID, traineeID)
+	if err != nil || teamID == "" {
+		return err
+	}
+
+	team, err := getTeamRecord(stub, platformID, teamID)
+	if err != nil || team == nil {
+		return err
+	}
+
+	err = quitTeam(stub, team, traineeID)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(stub, TeamMemberRemovedEventType, TeamMemberEvent{
+		CallerID:   callerID,
+		PlatformID: platformID,
+		TeamID:     teamID,
+		TraineeID:  traineeID,
+	})
+}
+
+// checkTeamCaller validates the caller and platform of a team transaction
+// and returns the platform
+func checkTeamCaller(stub shim.ChaincodeStubInterface, callerID string, platformID string) (*Platform, error) {
+	// Check if callerID starts with "admin" or "Trainer"
+	if !strings.HasPrefix(callerID, "admin") && !strings.HasPrefix(callerID, "Trainer") {
+		return nil, fmt.Errorf("Not authorized for that transaction.")
+	}
+
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return nil, err
+	}
+	if platformBytes == nil {
+		return nil, fmt.Errorf("Platform does not exist")
+	}
+
+	platform := &Platform{}
+	err = json.Unmarshal(platformBytes, platform)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal platform JSON")
+	}
+	return platform, nil
+}
+
+// onPlatform reports whether a trainee is registered on a platform
+func onPlatform(platform *Platform, traineeID string) bool {
+	for _, trainee := range platform.Trainees {
+		if trainee.TraineeID == traineeID {
+			return true
+		}
+	}
+	return false
+}
+
+// createTeam creates an empty team on a platform.
+// Arguments: administratorID or trainerID, platformID, teamID, name, optional cohort
+func (t *SimpleChaincode) createTeam(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID or trainerID, platformID, teamID, name and optional cohort")
+	}
+
+	callerID := args[0]
+	platformID := args[1]
+	teamID := args[2]
+
+	_, err := checkTeamCaller(stub, callerID, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if teamID == "" {
+		return shim.Error("teamID must not be empty")
+	}
+
+	// Check if the team already exists
+	existing, err := getTeamRecord(stub, platformID, teamID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("Team already exists")
+	}
+
+	team := Team{
+		DocType:    teamObjectType,
+		TeamID:     teamID,
+		PlatformID: platformID,
+		Name:       args[3],
+		Members:    []string{},
+		CreatedBy:  callerID,
+	}
+	if len(args) == 5 {
+		team.Cohort = args[4]
+	}
+
+	err = putTeam(stub, &team)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TeamCreatedEventType, TeamCreatedEvent{
+		CallerID: callerID,
+		Team:     team,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// addTeamMember adds a trainee of the platform to a team. A trainee belongs
+// to one team per platform; use moveTeamMember to change it.
+// Arguments: administratorID or trainerID, platformID, teamID, traineeID
+func (t *SimpleChaincode) addTeamMember(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID or trainerID, platformID, teamID and traineeID")
+	}
+
+	callerID := args[0]
+	platformID := args[1]
+	teamID := args[2]
+	traineeID := args[3]
+
+	platform, err := checkTeamCaller(stub, callerID, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !onPlatform(platform, traineeID) {
+		return shim.Error("Trainee is not registered in the specified platform")
+	}
+
+	team, err := getTeamRecord(stub, platformID, teamID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if team == nil {
+		return shim.Error("Team does not exist")
+	}
+
+	currentTeamID, err := teamOf(stub, platformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if currentTeamID != "" {
+		return shim.Error("Trainee is already a member of team " + currentTeamID + " on this platform")
+	}
+
+	err = joinTeam(stub, team, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TeamMemberAddedEventType, TeamMemberEvent{
+		CallerID:   callerID,
+		PlatformID: platformID,
+		TeamID:     teamID,
+		TraineeID:  traineeID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// removeTeamMember takes a trainee off the trainee's team on a platform.
+// Arguments: administratorID or trainerID, platformID, traineeID
+func (t *SimpleChaincode) removeTeamMember(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID or trainerID, platformID and traineeID")
+	}
+
+	callerID := args[0]
+	platformID := args[1]
+	traineeID := args[2]
+
+	_, err := checkTeamCaller(stub, callerID, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	teamID, err := teamOf(stub, platformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if teamID == "" {
+		return shim.Error("Trainee is not a member of a team on this platform")
+	}
+
+	err = leaveTeam(stub, callerID, platformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// moveTeamMember moves a trainee from the trainee's team on a platform to
+// another team of the same platform.
+// Arguments: administratorID or trainerID, platformID, traineeID, teamID
+func (t *SimpleChaincode) moveTeamMember(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID or trainerID, platformID, traineeID and teamID")
+	}
+
+	callerID := args[0]
+	platformID := args[1]
+	traineeID := args[2]
+	toTeamID := args[3]
+
+	_, err := checkTeamCaller(stub, callerID, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fromTeamID, err := teamOf(stub, platformID, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fromTeamID == "" {
+		return shim.Error("Trainee is not a member of a team on this platform")
+	}
+	if fromTeamID == toTeamID {
+		return shim.Error("Trainee is already a member of team " + toTeamID)
+	}
+
+	fromTeam, err := getTeamRecord(stub, platformID, fromTeamID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	toTeam, err := getTeamRecord(stub, platformID, toTeamID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fromTeam == nil || toTeam == nil {
+		return shim.Error("Team does not exist")
+	}
+
+	err = quitTeam(stub, fromTeam, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = joinTeam(stub, toTeam, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TeamMemberMovedEventType, TeamMemberMovedEvent{
+		CallerID:   callerID,
+		PlatformID: platformID,
+		TraineeID:  traineeID,
+		FromTeamID: fromTeamID,
+		ToTeamID:   toTeamID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getTeam returns a team with its members.
+// Arguments: platformID, teamID
+func (t *SimpleChaincode) getTeam(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and teamID")
+	}
+
+	team, err := getTeamRecord(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if team == nil {
+		return shim.Error("Team does not exist")
+	}
+
+	teamJSON, err := json.Marshal(team)
+	if err != nil {
+		return shim.Error("Failed to marshal team to JSON")
+	}
+
+	return shim.Success(teamJSON)
+}
+
+// getTeamLeaderboard ranks the teams of a platform by the points their
+// members earned there in the current season, most points first.
+// Arguments: platformID, optional cohort
+func (t *SimpleChaincode) getTeamLeaderboard(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting platformID and optional cohort")
+	}
+
+	platformID := args[0]
+	cohort := ""
+	if len(args) == 2 {
+		cohort = args[1]
+	}
+
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+	platform := Platform{}
+	err = json.Unmarshal(platformBytes, &platform)
+	if err != nil {
+		return shim.Error("Failed to unmarshal platform JSON")
+	}
+
+	// Completed vlabs are the ones passed under the platform's scoring rules
+	rules, err := getScoringRulesRecord(stub, platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The platform keeps a copy of every trainee's results on it
+	trainees := map[string]Trainee{}
+	for _, trainee := range platform.Trainees {
+		trainees[trainee.TraineeID] = trainee
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(teamObjectType, []string{platformID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	standings := []TeamStanding{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		team := Team{}
+		err = json.Unmarshal(queryResult.Value, &team)
+		if err != nil {
+			return shim.Error("Failed to unmarshal team JSON")
+		}
+		if cohort != "" && team.Cohort != cohort {
+			continue
+		}
+
+		standing := TeamStanding{
+			TeamID:  team.TeamID,
+			Name:    team.Name,
+			Cohort:  team.Cohort,
+			Members: len(team.Members),
+		}
+		// Members count their current season the way recalculateExpPoints
+		// does: the carried-over points and the vlabs no closed season holds
+		for _, member := range team.Members {
+			standing.TotalExpPoints += trainees[member].CarriedOver
+			for _, vlab := range trainees[member].VlabPointsMap2 {
+				if vlab.ClosedSeason != 0 {
+					continue
+				}
+				standing.TotalExpPoints += vlab.AwardedPoints
+				if rules.passes(vlab) {
+					standing.CompletedVlabs++
+				}
+			}
+		}
+		if standing.Members > 0 {
+			standing.AveragePoints = float64(standing.TotalExpPoints) / float64(standing.Members)
+		}
+		standings = append(standings, standing)
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].TotalExpPoints != standings[j].TotalExpPoints {
+			return standings[i].TotalExpPoints > standings[j].TotalExpPoints
+		}
+		return standings[i].CompletedVlabs > standings[j].CompletedVlabs
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+
+	standingsJSON, err := json.Marshal(standings)
+	if err != nil {
+		return shim.Error("Failed to marshal team leaderboard to JSON")
+	}
+
+	return shim.Success(standingsJSON)
+}
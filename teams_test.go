@@ -0,0 +1,83 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTeamLeaderboardFollowsSeasons(t *testing.T) {
+	stub := newTestPlatform(t)
+	mustInvoke(t, stub, "createTeam", "admin1", "p1", "red", "Red")
+	mustInvoke(t, stub, "addTeamMember", "admin1", "p1", "red", "t1")
+	mustInvoke(t, stub, "addTeamMember", "admin1", "p1", "red", "t2")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "100")
+	mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t2", "v1", "60")
+
+	standing := func() TeamStanding {
+		t.Helper()
+		standings := []TeamStanding{}
+		err := json.Unmarshal(mustInvoke(t, stub, "getTeamLeaderboard", "p1"), &standings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(standings) != 1 {
+			t.Fatalf("%d teams, want 1", len(standings))
+		}
+		return standings[0]
+	}
+	memberPoints := func() int {
+		t.Helper()
+		points := 0
+		for _, traineeID := range []string{"t1", "t2"} {
+			trainee := Trainee{}
+			getTestState(t, stub, traineeID, &trainee)
+			points += trainee.TotalExpPoints
+		}
+		return points
+	}
+
+	tests := []struct {
+		name      string
+		step      func()
+		points    int
+		completed int
+	}{
+		{"first season", func() {}, 160, 2},
+		// Half of every member's points carry over
+		{"closed season", func() { mustInvoke(t, stub, "closeSeason", "admin1", "p1", "", "0.5") }, 80, 0},
+		// A change to a closed season's result stays in that season
+		{"closed result changed", func() { mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t1", "v1", "50") }, 80, 0},
+		{"new season result", func() {
+			mustInvoke(t, stub, "addVlabToTrainee", "t2", "v2")
+			mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t2", "v2", "50")
+		}, 180, 1},
+		// A failing result earns points but does not complete the vlab
+		{"failing result", func() { mustInvoke(t, stub, "ScoreTheVlab", "Trainer1", "t2", "v2", "20") }, 120, 0},
+	}
+	for _, test := range tests {
+		test.step()
+		got := standing()
+		if got.TotalExpPoints != test.points || got.CompletedVlabs != test.completed {
+			t.Errorf("%s: team points %d with %d completed, want %d with %d", test.name, got.TotalExpPoints, got.CompletedVlabs, test.points, test.completed)
+		}
+		if members := memberPoints(); members != got.TotalExpPoints {
+			t.Errorf("%s: team points %d, members hold %d", test.name, got.TotalExpPoints, members)
+		}
+	}
+}
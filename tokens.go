@@ -0,0 +1,528 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The reward token is a fungible token kept in the style of the Fabric token
+// samples, under the composite keys
+//
+//	tokenbalance \x00 traineeID \x00                              the balance
+//	tokensupply \x00                                               the total supply
+//	tokensettings \x00 platformID \x00                             a platform's settings
+//	tokentx \x00 txID \x00                                         a TokenTransaction
+//	tokentxindex \x00 traineeID \x00 timestamp \x00 txID \x00     one per party
+//
+// Tokens are minted one per experience point when ScoreTheVlab awards a
+// trainee more points for a vlab than were ever minted for it, so lowering
+// and restoring a result mints nothing twice. Tokens are burned by their
+// holder or by an administrator, e.g. when redeemed in a reward store, and
+// move between trainees only on platforms that enable transfers. Every
+// transaction holds at most one token operation.
+const (
+	tokenBalanceObjectType  = "tokenbalance"
+	tokenSupplyObjectType   = "tokensupply"
+	tokenSettingsObjectType = "tokensettings"
+	tokenTxObjectType       = "tokentx"
+	tokenTxIndexObjectType  = "tokentxindex"
+)
+
+// Token transaction types
+const (
+	TokenMint     = "mint"
+	TokenTransfer = "transfer"
+	TokenBurn     = "burn"
+)
+
+// TokenSettings configures the reward token on a platform
+type TokenSettings struct {
+	DocType          string `json:"docType"`
+	PlatformID       string
+	TransfersEnabled bool
+}
+
+// TokenTransaction is one entry of the token's transaction log and the
+// payload of its TokenTransfer event. From is empty for a mint and To is
+// empty for a burn.
+type TokenTransaction struct {
+	DocType    string `json:"docType"`
+	TxID       string
+	Type       string
+	From       string `json:"From,omitempty"`
+	To         string `json:"To,omitempty"`
+	Amount     int
+	PlatformID string `json:"PlatformID,omitempty"`
+	Memo       string `json:"Memo,omitempty"`
+	CallerID   string
+	At         string
+}
+
+// TokenBalance is returned by tokenBalance
+type TokenBalance struct {
+	TraineeID string
+	Balance   int
+}
+
+// getIntState reads a number stored under a composite key, 0 if absent
+func getIntState(stub shim.ChaincodeStubInterface, objectType string, attributes []string) (int, string, error) {
+	key, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return 0, "", err
+	}
+
+	valueBytes, err := stub.GetState(key)
+	if err != nil {
+		return 0, "", err
+	}
+	if valueBytes == nil {
+		return 0, key, nil
+	}
+
+	value, err := strconv.Atoi(string(valueBytes))
+	if err != nil {
+		return 0, "", fmt.Errorf("Failed to read %s of %v", objectType, attributes)
+	}
+	return value, key, nil
+}
+
+// addTokens changes a trainee's balance and the total supply by amount,
+// which is negative for a debit, and returns the new balance
+func addTokens(stub shim.ChaincodeStubInterface, traineeID string, amount int, changeSupply bool) (int, error) {
+	balance, balanceKey, err := getIntState(stub, tokenBalanceObjectType, []string{traineeID})
+	if err != nil {
+		return 0, err
+	}
+	if amount < 0 && balance < -amount {
+		return 0, fmt.Errorf("Trainee %s holds %d tokens, fewer than %d", traineeID, balance, -amount)
+	}
+	if amount > 0 && balance > math.MaxInt-amount {
+		return 0, fmt.Errorf("Balance of trainee %s would overflow", traineeID)
+	}
+	balance += amount
+
+	err = stub.PutState(balanceKey, []byte(strconv.Itoa(balance)))
+	if err != nil {
+		return 0, err
+	}
+
+	if changeSupply {
+		supply, supplyKey, err := getIntState(stub, tokenSupplyObjectType, []string{})
+		if err != nil {
+			return 0, err
+		}
+		if amount > 0 && supply > math.MaxInt-amount {
+			return 0, fmt.Errorf("Total supply would overflow")
+		}
+		err = stub.PutState(supplyKey, []byte(strconv.Itoa(supply+amount)))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return balance, nil
+}
+
+// logTokenTransaction writes a token transaction to the log, indexes it
+// under every party and emits it
+func logTokenTransaction(stub shim.ChaincodeStubInterface, tx TokenTransaction) error {
+	at, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	tx.DocType = tokenTxObjectType
+	tx.TxID = stub.GetTxID()
+	tx.At = at.UTC().Format("2006-01-02T15:04:05.000000000Z")
+
+	txKey, err := stub.CreateCompositeKey(tokenTxObjectType, []string{tx.TxID})
+	if err != nil {
+		return err
+	}
+	// The log is keyed by transaction, so a second operation would replace
+	// the first
+	if events, ok := stub.(*eventStub); ok {
+		if events.tokenLogged {
+			return fmt.Errorf("Transaction %s already holds a token operation", tx.TxID)
+		}
+		events.tokenLogged = true
+	}
+
+	txJSON, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(txKey, txJSON)
+	if err != nil {
+		return err
+	}
+
+	for _, party := range []string{tx.From, tx.To} {
+		if party == "" {
+			continue
+		}
+		indexKey, err := stub.CreateCompositeKey(tokenTxIndexObjectType, []string{party, tx.At, tx.TxID})
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(indexKey, []byte{0x00})
+		if err != nil {
+			return err
+		}
+	}
+
+	return emitEvent(stub, TokenTransferEventType, tx)
+}
+
+// mintVlabTokens credits the tokens a trainee's vlab result earned beyond
+// what was minted for the vlab before, records the minted amount on the vlab
+// and returns the amount. The caller logs the mint with logMint once the
+// result's own events are emitted.
+func mintVlabTokens(stub shim.ChaincodeStubInterface, trainee *Trainee, vlab *Vlab) (int, error) {
+	amount := vlab.AwardedPoints - vlab.TokensMinted
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	_, err := addTokens(stub, trainee.TraineeID, amount, true)
+	if err != nil {
+		return 0, err
+	}
+	vlab.TokensMinted = vlab.AwardedPoints
+	return amount, nil
+}
+
+// logMint logs the tokens minted for a trainee's vlab result, if any
+func logMint(stub shim.ChaincodeStubInterface, trainerID string, trainee *Trainee, vlabID string, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	return logTokenTransaction(stub, TokenTransaction{
+		Type:       TokenMint,
+		To:         trainee.TraineeID,
+		Amount:     amount,
+		PlatformID: trainee.ActivePlatform,
+		Memo:       vlabID,
+		CallerID:   trainerID,
+	})
+}
+
+// getTokenSettingsRecord reads a platform's token settings, transfers
+// disabled if none were set
+func getTokenSettingsRecord(stub shim.ChaincodeStubInterface, platformID string) (*TokenSettings, error) {
+	settingsKey, err := stub.CreateCompositeKey(tokenSettingsObjectType, []string{platformID})
+	if err != nil {
+		return nil, err
+	}
+
+	settingsBytes, err := stub.GetState(settingsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &TokenSettings{DocType: tokenSettingsObjectType, PlatformID: platformID}
+	if settingsBytes == nil {
+		return settings, nil
+	}
+	err = json.Unmarshal(settingsBytes, settings)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// parseTokenAmount reads a positive token amount
+func parseTokenAmount(amount string) (int, error) {
+	value, err := strconv.Atoi(amount)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("amount must be a positive integer")
+	}
+	return value, nil
+}
+
+// setTokenTransfers enables or disables token transfers between the
+// trainees of a platform.
+// Arguments: administratorID, platformID, enabled (true or false)
+func (t *SimpleChaincode) setTokenTransfers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting administratorID, platformID and enabled")
+	}
+
+	administratorID := args[0]
+	platformID := args[1]
+
+	// Check if administratorID starts with "admin"
+	if !strings.HasPrefix(administratorID, "admin") {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	enabled, err := strconv.ParseBool(args[2])
+	if err != nil {
+		return shim.Error("enabled must be true or false")
+	}
+
+	platformBytes, err := stub.GetState(platformID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if platformBytes == nil {
+		return shim.Error("Platform does not exist")
+	}
+
+	settings := TokenSettings{
+		DocType:          tokenSettingsObjectType,
+		PlatformID:       platformID,
+		TransfersEnabled: enabled,
+	}
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return shim.Error("Failed to marshal token settings to JSON")
+	}
+	settingsKey, err := stub.CreateCompositeKey(tokenSettingsObjectType, []string{platformID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(settingsKey, settingsJSON)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emitEvent(stub, TokenSettingsSetEventType, TokenSettingsSetEvent{
+		AdministratorID: administratorID,
+		Settings:        settings,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// transferTokens moves tokens from one trainee to another trainee of the
+// same platform, if the platform enables transfers.
+// Arguments: fromTraineeID, toTraineeID, amount, optional memo
+func (t *SimpleChaincode) transferTokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting fromTraineeID, toTraineeID, amount and optional memo")
+	}
+
+	fromID := args[0]
+	toID := args[1]
+	memo := ""
+	if len(args) == 4 {
+		memo = args[3]
+	}
+
+	amount, err := parseTokenAmount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fromID == toID {
+		return shim.Error("Cannot transfer tokens to the same trainee")
+	}
+
+	from, err := getTraineeRecord(stub, fromID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	to, err := getTraineeRecord(stub, toID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if from.ActivePlatform == "" || from.ActivePlatform != to.ActivePlatform {
+		return shim.Error("Tokens move only between trainees of the same platform")
+	}
+
+	settings, err := getTokenSettingsRecord(stub, from.ActivePlatform)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !settings.TransfersEnabled {
+		return shim.Error("Platform " + from.ActivePlatform + " does not allow token transfers")
+	}
+
+	_, err = addTokens(stub, fromID, -amount, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = addTokens(stub, toID, amount, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = logTokenTransaction(stub, TokenTransaction{
+		Type:       TokenTransfer,
+		From:       fromID,
+		To:         toID,
+		Amount:     amount,
+		PlatformID: from.ActivePlatform,
+		Memo:       memo,
+		CallerID:   fromID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// burnTokens destroys tokens of a trainee, for instance when they are
+// redeemed in a reward store. Trainees burn their own tokens, administrators
+// anyone's.
+// Arguments: callerID, traineeID, amount, optional memo
+func (t *SimpleChaincode) burnTokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting callerID, traineeID, amount and optional memo")
+	}
+
+	callerID := args[0]
+	traineeID := args[1]
+	memo := ""
+	if len(args) == 4 {
+		memo = args[3]
+	}
+
+	// Check if callerID starts with "admin" or is the trainee
+	if !strings.HasPrefix(callerID, "admin") && callerID != traineeID {
+		return shim.Error("Not authorized for that transaction.")
+	}
+
+	amount, err := parseTokenAmount(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	trainee, err := getTraineeRecord(stub, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, err = addTokens(stub, traineeID, -amount, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = logTokenTransaction(stub, TokenTransaction{
+		Type:       TokenBurn,
+		From:       traineeID,
+		Amount:     amount,
+		PlatformID: trainee.ActivePlatform,
+		Memo:       memo,
+		CallerID:   callerID,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// tokenBalance returns the token balance of a trainee.
+// Arguments: traineeID
+func (t *SimpleChaincode) tokenBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	balance, _, err := getIntState(stub, tokenBalanceObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	balanceJSON, err := json.Marshal(TokenBalance{TraineeID: args[0], Balance: balance})
+	if err != nil {
+		return shim.Error("Failed to marshal token balance to JSON")
+	}
+
+	return shim.Success(balanceJSON)
+}
+
+// tokenTotalSupply returns the number of tokens in circulation.
+// Arguments: none
+func (t *SimpleChaincode) tokenTotalSupply(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting none")
+	}
+
+	supply, _, err := getIntState(stub, tokenSupplyObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(strconv.Itoa(supply)))
+}
+
+// getTokenTransactions returns the token transactions of a trainee, oldest
+// first.
+// Arguments: traineeID
+func (t *SimpleChaincode) getTokenTransactions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(tokenTxIndexObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	transactions := []TokenTransaction{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		txKey, err := stub.CreateCompositeKey(tokenTxObjectType, []string{attributes[2]})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		txBytes, err := stub.GetState(txKey)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if txBytes == nil {
+			continue
+		}
+
+		tx := TokenTransaction{}
+		err = json.Unmarshal(txBytes, &tx)
+		if err != nil {
+			return shim.Error("Failed to unmarshal token transaction JSON")
+		}
+		transactions = append(transactions, tx)
+	}
+
+	transactionsJSON, err := json.Marshal(transactions)
+	if err != nil {
+		return shim.Error("Failed to marshal token transactions to JSON")
+	}
+
+	return shim.Success(transactionsJSON)
+}
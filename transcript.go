@@ -0,0 +1,280 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The transcript is the learning record kept next to the trainee
+// under the key "transcript\x00<traineeID>\x00". Trainee only holds the current
+// platform and TransferTrainee1 drops vlabs the new platform lacks, so the
+// transcript is the only place where that history survives.
+const transcriptObjectType = "transcript"
+
+// PlatformMembership is one period a trainee belonged to a platform
+type PlatformMembership struct {
+	PlatformID string
+	JoinedAt   time.Time
+	LeftAt     *time.Time `json:"LeftAt,omitempty"`
+}
+
+// Grade is one result recorded by a trainer. A competition event's dynamic
+// scoring re-awards a result with a grade given by the event's ID.
+type Grade struct {
+	Result        string
+	TimeSpent     string `json:"TimeSpent,omitempty"`
+	AwardedPoints int
+	GradedBy      string
+	GradedAt      time.Time
+}
+
+// VlabAttempt is one assignment of a vlab with every grade it received
+type VlabAttempt struct {
+	VlabID        string
+	PlatformID    string
+	BoxName       string
+	Domain        string
+	BoxDifficulty string
+	AssignedAt    time.Time
+	Deadline      *time.Time `json:"Deadline,omitempty"`
+	Grades        []Grade
+	RemovedAt     *time.Time `json:"RemovedAt,omitempty"`
+}
+
+// Transcript is the stored learning record of a trainee
+type Transcript struct {
+	TraineeID string
+	Platforms []PlatformMembership
+	Vlabs     []VlabAttempt
+}
+
+// DomainTotal sums a trainee's attempts in one domain
+type DomainTotal struct {
+	Domain    string
+	Attempted int
+	Completed int
+	Points    float64
+}
+
+// TranscriptReport is returned by getTranscript
+type TranscriptReport struct {
+	Transcript
+	DomainTotals []DomainTotal
+}
+
+// join opens a membership period on a platform
+func (transcript *Transcript) join(platformID string, at time.Time) {
+	transcript.Platforms = append(transcript.Platforms, PlatformMembership{
+		PlatformID: platformID,
+		JoinedAt:   at,
+	})
+}
+
+// leave closes the open membership period on a platform
+func (transcript *Transcript) leave(platformID string, at time.Time) {
+	for i := range transcript.Platforms {
+		if transcript.Platforms[i].PlatformID == platformID && transcript.Platforms[i].LeftAt == nil {
+			transcript.Platforms[i].LeftAt = &at
+		}
+	}
+}
+
+// assign records a new attempt at a vlab
+func (transcript *Transcript) assign(vlab Vlab, platformID string, at time.Time) {
+	transcript.Vlabs = append(transcript.Vlabs, VlabAttempt{
+		VlabID:        vlab.VlabID,
+		PlatformID:    platformID,
+		BoxName:       vlab.BoxName,
+		Domain:        vlab.Domain,
+		BoxDifficulty: vlab.BoxDifficulty,
+		AssignedAt:    at,
+		Deadline:      vlab.Deadline,
+		Grades:        []Grade{},
+	})
+}
+
+// currentAttempt returns the attempt at a vlab that has not been removed
+func (transcript *Transcript) currentAttempt(vlabID string) *VlabAttempt {
+	for i := len(transcript.Vlabs) - 1; i >= 0; i-- {
+		if transcript.Vlabs[i].VlabID == vlabID && transcript.Vlabs[i].RemovedAt == nil {
+			return &transcript.Vlabs[i]
+		}
+	}
+	return nil
+}
+
+// grade adds the vlab's result to the current attempt at it
+func (transcript *Transcript) grade(vlab Vlab, platformID string, graderID string, at time.Time) {
+	attempt := transcript.currentAttempt(vlab.VlabID)
+	if attempt == nil {
+		// The vlab was assigned before transcripts were kept
+		transcript.assign(vlab, platformID, time.Time{})
+		attempt = &transcript.Vlabs[len(transcript.Vlabs)-1]
+	}
+	attempt.Grades = append(attempt.Grades, Grade{
+		Result:        vlab.Result,
+		TimeSpent:     vlab.TimeSpent,
+		AwardedPoints: vlab.AwardedPoints,
+		GradedBy:      graderID,
+		GradedAt:      at,
+	})
+}
+
+// remove marks the current attempt at a vlab as dropped
+func (transcript *Transcript) remove(vlabID string, at time.Time) {
+	attempt := transcript.currentAttempt(vlabID)
+	if attempt != nil {
+		attempt.RemovedAt = &at
+	}
+}
+
+// getTranscriptRecord reads a trainee's transcript, or an empty one if none was kept yet
+func getTranscriptRecord(stub shim.ChaincodeStubInterface, traineeID string) (*Transcript, error) {
+	transcriptKey, err := stub.CreateCompositeKey(transcriptObjectType, []string{traineeID})
+	if err != nil {
+		return nil, err
+	}
+
+	transcriptBytes, err := stub.GetState(transcriptKey)
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := &Transcript{
+		TraineeID: traineeID,
+		Platforms: []PlatformMembership{},
+		Vlabs:     []VlabAttempt{},
+	}
+	if transcriptBytes != nil {
+		err = json.Unmarshal(transcriptBytes, transcript)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transcript, nil
+}
+
+// updateTranscript applies an update to a trainee's transcript and saves it
+func updateTranscript(stub shim.ChaincodeStubInterface, traineeID string, update func(transcript *Transcript, at time.Time)) error {
+	transcript, err := getTranscriptRecord(stub, traineeID)
+	if err != nil {
+		return err
+	}
+
+	at, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	update(transcript, at)
+
+	transcriptJSON, err := json.Marshal(transcript)
+	if err != nil {
+		return err
+	}
+
+	transcriptKey, err := stub.CreateCompositeKey(transcriptObjectType, []string{traineeID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(transcriptKey, transcriptJSON)
+}
+
+// lastGrade returns the latest grade of an attempt
+func (attempt *VlabAttempt) lastGrade() (Grade, bool) {
+	if len(attempt.Grades) == 0 {
+		return Grade{}, false
+	}
+	return attempt.Grades[len(attempt.Grades)-1], true
+}
+
+// domainTotals sums the attempts of a transcript per domain. Points add up
+// the points awarded for the latest grade of every attempt, including
+// dropped ones.
+func domainTotals(transcript *Transcript) []DomainTotal {
+	totals := map[string]*DomainTotal{}
+	for i := range transcript.Vlabs {
+		attempt := &transcript.Vlabs[i]
+		total, exists := totals[attempt.Domain]
+		if !exists {
+			total = &DomainTotal{Domain: attempt.Domain}
+			totals[attempt.Domain] = total
+		}
+		total.Attempted++
+
+		grade, graded := attempt.lastGrade()
+		if !graded || grade.Result == "" {
+			continue
+		}
+		total.Completed++
+		total.Points += float64(grade.AwardedPoints)
+	}
+
+	domains := []string{}
+	for domain := range totals {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	result := []DomainTotal{}
+	for _, domain := range domains {
+		result = append(result, *totals[domain])
+	}
+	return result
+}
+
+// getTranscript returns the complete learning record of a trainee.
+// Arguments: traineeID
+func (t *SimpleChaincode) getTranscript(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting traineeID")
+	}
+
+	traineeID := args[0]
+
+	transcript, err := getTranscriptRecord(stub, traineeID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(transcript.Platforms) == 0 && len(transcript.Vlabs) == 0 {
+		// An empty transcript is only valid for an existing trainee
+		traineeBytes, err := stub.GetState(traineeID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if traineeBytes == nil {
+			return shim.Error("Trainee does not exist")
+		}
+	}
+
+	report := TranscriptReport{
+		Transcript:   *transcript,
+		DomainTotals: domainTotals(transcript),
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error("Failed to marshal transcript to JSON")
+	}
+
+	return shim.Success(reportJSON)
+}